@@ -3,409 +3,692 @@ NAME
   sketch - sketch an image or video
 
 SYNOPSIS
-  sketch [-framelimit -iter -l -p -save -start -stat] [file]
+  sketch [flags] [file]
   ffmpeg -i input.webm input_%03d.png && sketch && ffmpeg -i frame_%03d.png output.webm
+  sketch -video input.webm -encode output.webm
+  sketch replay [-o pattern] file
+  sketch serve [-listen address] [-grpc address] [flags]
 
 DESCRIPTION
   Sketch approximates input images using randomly placed lines.
 
+  Each file named on the command line is sketched in turn, in the order
+  given. Arguments may be glob patterns, which are expanded in sorted order,
+  or http or https URLs, which are downloaded. So may the image files given
+  to -init, -mask, -weight, -palette-from and -brush. A download taking over
+  a minute or of something other than an image is an error. Built with -tags
+  cloud, sketch also reads images, and writes frames with -outdir, from and
+  to Amazon S3 or Google Cloud Storage, named as s3://bucket/key or
+  gs://bucket/key, and so may the other files it reads and writes, such as
+  checkpoints and logs, for batch jobs in the cloud without a shared
+  filesystem. The name - reads an image from standard input, and then
+  finished frames are written to standard output as PNG instead of to files,
+  so that sketch can be used in a pipeline:
+
+    curl -s https://example.com/photo.jpg | sketch - > sketch.png
+
+  The -alpha flag draws strokes translucent, blending each over what is
+  already on the canvas, so that overlapping strokes mix their colours like
+  paint. Candidates are judged by the blended result.
+
+  The -brush flag paints lines with a brush tip image instead, so that a
+  sketch can look like charcoal, crayon or marker. The tip is stamped along
+  each line at its own size, turned to follow the line, and covers the
+  canvas by its luminance: white paints in full, and black not at all.
+  Brush strokes are drawn as plain lines in -svg output.
+
+  The -shape flag selects curves, which are quadratic Bézier curves bent
+  toward a random control point, polylines of two to five short segments
+  turning this way and that like a scribble, or filled rectangles, circles,
+  ellipses or triangles instead of lines. The -l flag bounds the size of
+  any shape. The stipple shape draws dots of up to five pixels across
+  instead, for pointillist renderings; being so small, they gather where
+  the source has detail.
+
+  The -width flag draws lines that many pixels wide, with round ends, or
+  at a width picked at random from a range such as 2-5, which reads better
+  than one pixel lines at high resolutions. Other shapes are unaffected.
+
+  The -l flag may also be a schedule, such as 120:10, for the length to go
+  from the first number at the first iteration of a frame to the second at
+  the last, so that early strokes block in large shapes and later ones add
+  fine detail. It goes linearly, or with -l-decay exp, by the same factor
+  every iteration. A schedule needs an -iter limit and a single job, and
+  can't be changed while running.
+
+  The -aa flag draws lines anti-aliased, with Xiaolin Wu's algorithm for
+  one pixel wide lines and soft edges for wider ones, blending them into
+  the pixels they partly cover. Candidates are judged by how the pixels
+  would look with them blended in. Other shapes are drawn as usual.
+
   The -p flag removes duplicate colours from the palette, which means a more
   uniformly random selection of colours is used to draw lines. Some images,
-  like line art, may converge faster with the -p flag enabled.
+  like line art, may converge faster with the -p flag enabled. The -colors
+  flag reduces the palette to that many representative colours, found by
+  k-means clustering, for a posterized, screen-printed look; with -p as
+  well, each is as likely to be picked as any other. Without -p, the
+  palette of an image with more pixels than -palette-size is a random
+  sample of that many of them, to bound the memory it takes.
+
+  The -color flag chooses how strokes are coloured. By default, each takes a
+  random colour from the palette: the colours of the source, or of another
+  image given with -palette-from, to paint one image in the colours of
+  another. With start or mid, each takes the colour of the source at its
+  start or middle instead, which does without the palette and converges
+  faster on photographs. With avg, each takes the average colour of the
+  source under it, which gives cleaner results on smooth gradients. With
+  best, each takes the colour that leaves the least squared error over the
+  pixels it covers, allowing for the blending of -aa, -alpha or -brush, so
+  that only the shapes are left to chance.
+
+  With -gpu, line candidates are scored in batches of -gpu-batch on the GPU,
+  and only the best of each batch is tried. This needs a build with the
+  opencl tag; otherwise sketch logs a warning and falls back to the CPU.
+
+  Runs are reproducible: each frame's random number generator is seeded from
+  -seed plus the frame's index, and the seed in use is logged. Pass -seed
+  random to get a different sketch each time, and pass the logged seed back
+  in to repeat it.
+
+  The -jobs flag sketches that many frames at once. Each frame comes out the
+  same as it would on its own, and frames are written, and their log output
+  printed, in order. A timelapse can only be recorded with a single job.
+
+  To spread the frames over several machines, run sketch with -coordinator
+  and a listen address, and start workers elsewhere with -worker and the
+  coordinator's URL, such as http://host:8080. The coordinator reads and
+  writes the frames, and hands up to -jobs of them at a time out to the
+  workers, along with its flags. A frame that a worker doesn't return within
+  the -lease time is handed to another worker.
+
+  The serve subcommand runs sketch as an HTTP service for web apps,
+  listening on the address given by -listen, :8080 by default. POST an image
+  to /jobs to have it sketched, with the flags sketch was started with and
+  an iter parameter in place of -iter, as many at once as -jobs. The reply
+  has the job's id, and GET /jobs/id has its state and latest statistics,
+  /jobs/id/canvas the canvas as of those statistics, and /jobs/id/result the
+  sketch once it is done, in -format. Built with -tags grpc, sketch serve
+  also serves the gRPC service of sketch.proto on the -grpc address, to
+  submit jobs, stream their progress and get their results from other
+  services.
+
+  The -watch flag makes sketch a drop folder: it watches a directory for
+  image files and sketches each as it appears, up to -jobs at once, saving
+  it in -outdir under the same name with the -format extension, until
+  interrupted. Files are taken once they stop changing, and sketched again
+  if replaced. Images already there are sketched too, unless their sketch is
+  already in -outdir and -overwrite isn't set.
+
+  Built with GOOS=js GOARCH=wasm, sketch runs entirely in a browser, for
+  demos, and gives JavaScript a sketch object with loadImage to start
+  sketching an ImageData, step to sketch a number of iterations, and
+  canvasRGBA to get the canvas back as ImageData's data. See sketch/wasm.go.
+
+  Built with -tags cshared -buildmode=c-shared, sketch is a shared library
+  with the C interface in sketch.h, for Python, Rust, Node and others to
+  sketch images in-process, at once with SketchImage, or a step at a time
+  with SketchNew and SketchStep, with flags set by SketchSetFlag.
+
+  The core of sketch is the package github.com/Hypeouseaus/sketchfy/sketch,
+  which Go programs can import to sketch images in memory, with SetFlag and
+  Sketch. The github.com/Hypeouseaus/sketchfy/mobile package wraps it for
+  gomobile bind, for Android and iOS apps to sketch photos on the device,
+  passing images as the bytes of image files, with a progress callback.
+
+  The -window flag shows the canvas in a desktop window as it is sketched,
+  with the latest statistics over it. Space pauses and resumes sketching, S
+  saves the canvas as an incremental save, and Q or Escape stops, like an
+  interrupt. It needs sketch built with -tags window.
+
+  The -rtmp flag streams the canvas live as it is sketched to an RTMP
+  server, such as a Twitch or YouTube ingest URL with the stream key, encoded
+  by ffmpeg as H.264 at 30 frames a second, for broadcasting a sketch as it
+  converges.
+
+  The -ndi flag sends the canvas as it is sketched as an NDI video source of
+  the given name, up to 30 frames a second, for OBS, Resolume and other
+  live video software to take in over the network. It needs sketch built
+  with -tags ndi and the NDI SDK.
+
+  The -term-preview flag draws the canvas, scaled down, in the terminal
+  every -stat interval, for watching a sketch over SSH, using the Kitty or
+  iTerm2 graphics protocols or sixel graphics. With auto, the protocol is
+  guessed from the environment, falling back to sixel.
+
+  The -preview flag serves a page on the given address that shows the canvas
+  and statistics of the frame being sketched, updated every -stat interval
+  over a WebSocket, to watch it converge in a browser tab. It works when
+  serving too, showing whichever job was updated last.
+
+  The -control flag listens on the given address, or on a Unix socket with
+  unix:path, for changes to -l, -save, -alpha, -iter, -colors and -rate while
+  a single job runs, so that a long run can be tuned without starting it
+  again. GET /params returns the values in use; POST /params?l=20&alpha=128,
+  with any of them, changes them within the next 50 iterations. Strokes keep
+  the opacity they were drawn with in -svg and -strokelog output.
+
+  The -osc and -midi flags take the same changes live, to play sketch like
+  an instrument: -osc as OSC messages to /sketch/l, /sketch/alpha and so on
+  on a UDP address, and -midi as control changes 1 to 4 from a raw MIDI
+  device, setting -l, -alpha, -colors and -rate over their ranges. The -rate
+  flag limits the iterations sketched a second, to slow the sketch down to
+  watch it.
+
+  An interrupt (SIGINT or SIGTERM) stops sketching the current frame, which
+  is written out as usual before exiting. Interrupt again to quit at once.
+
+  SIGUSR2 pauses sketching, and the next SIGUSR2 resumes it, for making way
+  for other work on a shared machine without losing the run. A paused
+  sketch sleeps rather than spinning, and the time paused doesn't count
+  towards -duration or the statistics.
+
+  SIGUSR1 makes an incremental save of the canvas at once, as -save would,
+  to look at a long run whenever you like, paused or not.
+
+  The -checkpoint flag saves the state of the run to a file every
+  -checkpoint-interval, after each frame and on an interrupt. After a crash
+  or an interrupt, run sketch with -resume and the same file to carry on
+  where it stopped, with the original flags and file arguments. The result
+  is the same as that of an uninterrupted run. Checkpoints need a single
+  job, and a resumed run can't add to -encode or -gif output.
+
+  Each frame is sketched for -iter iterations, for at most -duration, until
+  the -strokes limit of accepted lines is reached, or until the sketch is
+  within the -target error of the source: the root mean square difference
+  per colour channel, where 0 is identical and 1 is as different as possible.
+
+  The -plateau flag stops a frame early once sketching it has all but
+  stopped paying off: when the RMS error has fallen by less than that
+  fraction of itself, such as 0.001, over the last -plateau-window
+  iterations, rather than always using up -iter. A frame resumed from a
+  checkpoint starts measuring afresh.
+
+  Candidates are scored by their distance from the source in RGB, as stored,
+  with the sRGB gamma curve. With -metric linear, they are scored in linear
+  light instead, where a difference counts as much as the light it makes, so
+  that mistakes in the shadows count for less and mistakes in the highlights
+  for more: bright areas come out cleaner, dark areas coarser, and a mix of
+  strokes averages out to the right brightness when seen from a distance.
+  With -metric lab, they are scored by their delta E in CIELAB instead,
+  which follows how different colours look more closely, at some cost in
+  speed. The -target error is then measured in delta E, where 1 is a delta E
+  of 100, the distance from black to white. With -metric ssim, they are
+  scored by the structural similarity (SSIM) to the source of the windows
+  of 7 by 7 pixels around the pixels they cover, which is much slower but
+  judges strokes by how they fit in with the texture around them, and
+  does better on textured images. The -target error is still measured in
+  RGB.
+
+  The -weights flag weights the channels' squared differences, red, green,
+  blue and alpha, or L, a, b and alpha with lab, such as 2,1,1,0 to stress
+  brightness and ignore alpha, and the -target error is measured with the
+  same weights. For a source with transparency sketched on an opaque
+  background, -no-alpha leaves alpha out, as a weight of 0 would, so that
+  strokes are judged by colour alone.
+
+  The -candidates flag scores that many candidates each iteration, and only
+  tries the best of them, so that fewer but better strokes are accepted for
+  the same work, as -gpu does with its batches. With -gpu, each is the best
+  of a batch.
+
+  The -tiles flag splits each frame into tiles of that many pixels square,
+  overlapping by -tile-overlap, and sketches each on its own, up to
+  -tile-jobs at once, for -iter iterations, before stitching them back
+  together, for poster-size frames, which converge far faster a tile at a
+  time. Each tile is blended across its overlap with the tiles before it,
+  to hide the seams, but in -svg output its strokes are drawn whole.
+
+  The -max-memory flag keeps sketch within a budget of bytes, such as
+  -max-memory 4G, given with a suffix of K, M or G or without one. A frame
+  too large to sketch whole within its share of the budget, split between
+  -jobs, is sketched in -tiles as large as fit, as only the source and the
+  canvases are then held at full size. What a frame takes is reckoned from
+  the buffers sketching it allocates, counting those of options such as
+  -weight, -residual and -flow, so the budget is kept but for what the Go
+  runtime and the strokes kept for -svg take besides.
+
+  The -restarts flag sketches each frame that many times over, each seeded
+  differently, up to -restart-jobs at once, and keeps the sketch that ends
+  up closest to the source, by the RMS error of -target, as random search
+  sometimes gets off to a better start than others. The first restart is
+  seeded as the frame would be without -restarts. With -restarts-out, the
+  others are written too, as restart_001_1 and so on, numbered by frame and
+  restart, to compare.
+
+  The -pyramid flag sketches each frame coarse to fine, in that many levels:
+  first from the source scaled down by half for each level past the first,
+  where strokes cover that much more of the frame and large areas fill in
+  fast, and then at each size up to the full one, starting from the canvas
+  of the level before scaled up, to refine it. The full size gets -iter
+  iterations, and each level below it a quarter of those of the one above.
+  The strokes of coarser levels are scaled up in -svg and -strokelog output.
+
+  The -genetic flag evolves a population of that many candidates each
+  iteration, for -generations generations, and tries the best, for
+  experimenting with the search. Each generation keeps the better half,
+  and replaces the rest with children of pairs of them, each taking where
+  it starts from one parent and its shape from there from the other, and
+  its colour from either, and half of them then mutated, as -climb would.
+
+  The -climb flag improves each candidate before it is judged, by hill
+  climbing: it is mutated that many times, moving an end, corner or centre
+  of it a little, or with -color palette picking another colour, and each
+  mutation that would leave the sketch closer to the source is kept. Each
+  candidate then costs more, but is far more often good enough to accept.
+
+  Only candidates that bring the sketch closer to the source are normally
+  accepted, which can leave it stuck repeating the same local structure.
+  With -anneal, worse ones are sometimes accepted too, as in simulated
+  annealing: early on, while the temperature is high, and less and less
+  often as it cools. A candidate that makes the pixels it covers worse by
+  the fraction -anneal-temp is at first accepted with odds of 1 in e, and
+  the temperature is multiplied by -anneal-cool each iteration.
+
+  The -report flag logs the peak signal to noise ratio (PSNR) and the mean
+  SSIM of the sketch to the source, in red, green and blue, for each
+  incremental save and finished frame, to compare the results of different
+  flags by the numbers rather than by eye.
 
+  With -adaptive, -iter is instead the average number of iterations per
+  frame. Frames that start further from their source, such as those after a
+  scene cut, are given more iterations, and frames that change little from
+  the one before them with -warm are given fewer, so that quality evens out
+  across a video without the run as a whole taking longer.
+
+  The -svg flag additionally records every accepted line and writes them out
+  as vector <line> elements, for resolution independent output.
+
+  The -strokelog flag appends every accepted line, with its frame and
+  iteration, to a JSON lines file. The replay subcommand re-renders the
+  frames of such a log to replay_%03d.png, or to the -o name pattern.
+
+  Without file arguments, input frames are read from numbered files named by
+  the -in-pattern flag, starting at -start. Finished frames are written to
+  files named by -out-pattern, inside -outdir if given, in the -format
+  image format. JPEG and WebP output take a -quality, and WebP may instead
+  be -lossless. WebP is encoded with ffmpeg.
+  Patterns are printf style with a single integer verb, such as %03d, or
+  use a run of # characters for a zero padded number of that width, so
+  frame_#### is the same as frame_%04d.
+
+  Output numbering carries on after the highest numbered frame and
+  incremental save already in the output directory, so that running sketch
+  again doesn't replace earlier output. Pass -overwrite to start from 1.
+
+  The -max-dim flag scales sources larger than that many pixels across or
+  down to fit before sketching them, such as -max-dim 1920 for an 8000
+  pixel photograph, which random search would take hopelessly long over.
+  The SVG of -svg stays the size of the source, and -strokelog records the
+  factor by which each frame was scaled down, so that the strokes can be
+  drawn again at full size.
+
+  The -crop flag sketches only a rectangle of each source, given as x,y,w,h
+  in pixels from its top left corner, or as percentages of its width and
+  height, such as -crop 25%,25%,50%,50% for the middle of it. Frames are
+  written at the size of the rectangle, or with -crop-composite, of the
+  whole source with the sketch drawn over the rectangle. Cropping comes
+  before -max-dim, which scales the rectangle.
+
+  Every frame of an animated GIF input is sketched, producing one output
+  frame each. The -gif flag assembles the output frames into an animated GIF,
+  keeping the delays of an animated input or else showing -fps frames per
+  second.
+
+  The canvas starts out black. The -bg flag sets another background: white,
+  transparent, a hex colour such as #336699 or #33669980 with alpha, or
+  avg for the average colour of each frame's source. Transparent backgrounds
+  need an output format with alpha, such as PNG.
+
+  The -init flag draws an image file, such as an earlier sketch or a
+  texture, over the background of each canvas before sketching on top of
+  it, scaled to the size of the frame. Workers read it from the same path.
+
+  The -mask flag restricts strokes to the light parts of an image file,
+  scaled to the size of the frame, so that the parts under its dark pixels
+  are left as they are, and only colours from the rest of the source are
+  used. With a mask, the -target error still counts the whole frame.
+
+  The -weight flag gives some parts of the frame more attention than
+  others, such as a face over a plain background. Strokes are placed in
+  proportion to the luminance of an image file, scaled to the size of the
+  frame, and the colour distance at each pixel is scaled by it when judging
+  a stroke, so that black parts count for nothing.
+
+  The -edges flag places more strokes along edges in the source, found by
+  a Sobel filter, which helps line art and high contrast photos converge
+  faster. At 1, strokes only start on edges; at 0.5, a flat area gets half
+  the strokes it would otherwise.
+
+  The -focus flag places strokes where the sketch is still furthest from
+  the source, so that late in a run they aren't wasted on parts that are
+  already done. The error is kept summed over a quadtree of cells as
+  strokes are drawn, and at a -focus of 1, every stroke starts in a cell
+  picked in proportion to its error; at 0.5, half of them do, and the rest
+  are placed as usual.
+
+  The -residual flag places every stroke in proportion to the error left at
+  each pixel instead, times its -weight and -edges bias, as of every that
+  many iterations, when a table to pick pixels from in constant time is
+  rebuilt from the error map. It is finer grained than -focus, but goes out
+  of date between rebuilds.
+
+  The -flow flag turns lines to follow the contours of the source, like the
+  strokes of a pen drawing, and -flow-cross turns them across the contours
+  instead. At a -flow of 1, lines run exactly along clear contours; lower
+  values leave them some of their random direction. Lines in flat areas,
+  with no clear contour, keep their random direction.
+
+  The -angles flag only draws lines at the listed angles, such as 0,45,90,
+  for a hatched look. Angles are in degrees anticlockwise from horizontal.
+  With -flow as well, each line takes the listed angle nearest the contour.
+
+  The -ink flag draws in that one colour only, for a black on white or white
+  on black sketch, and the source is sketched in grey tones of the ink on
+  the background, so that tone comes only from how densely strokes cover
+  it; -alpha lets it build up where strokes overlap as well. Dark ink goes
+  on a white background and light ink on a black one, unless -bg says
+  otherwise.
+
+  The -duotone flag maps the source by brightness onto the ramp between two
+  colours, such as #1b2a4a,#f3e9d2 for navy to cream, and sketches that, so
+  that strokes only take colours from the ramp, for the look of a two-ink
+  print. The background is the light end of the ramp, unless -bg says
+  otherwise.
+
+  The -hatch flag shades like a pen drawing instead, with layers of hatching
+  in -ink, black by default, on the background. The source is turned into
+  a hatched drawing of itself, with up to the given number of layers, each
+  at an angle of its own and covering the parts needing more ink than the
+  one before, and the lines are sketched from that at the hatching angles.
+  The -hatch-spacing flag sets the distance apart of the lines in each
+  layer. Hatching works best with lines.
+
+  Each frame is normally sketched from a blank canvas. The -warm flag starts
+  each frame from the finished sketch of the one before instead, which for
+  video needs far fewer iterations per frame and flickers less. The SVG of
+  a warm frame includes the strokes of the frames before it, and the stroke
+  log marks it to be replayed on top of the previous frame. Warm frames are
+  sketched one at a time. A frame that differs from the one before by more
+  than -scene-cut, measured like -target, is taken to start a new scene,
+  and is sketched from a blank canvas so that the old scene doesn't show
+  through. A -scene-cut of 0 never starts afresh.
+
+  Statistics on each frame's progress are logged every -stat interval. The
+  -stats-format flag can have them written as a line of JSON each instead,
+  to standard output or to the -stats-out file, with the frame's index, the
+  iterations done, the iterations and accepted strokes per second over the
+  interval, the strokes accepted, the RMS error and the seconds elapsed, for
+  scripts and dashboards to follow. The -stats-file flag appends them to a
+  CSV file as well, a row each under a header row, for plotting how
+  sketching converges after the run.
+
+  Progress is logged to standard error as a message followed by fields as
+  key=value, such as the frame and iterations, where a frame's lines are
+  kept together. Pass -v to log in more detail, -q to log only warnings and
+  errors, and -log-format json to log each line as JSON, for log collectors
+  to parse. The -quiet flag leaves out the progress logged every -stat
+  interval, and -logfile appends the logs to a file instead, for when sketch
+  is run from scripts that read its output.
+
+  The -pprof flag serves the profiles of net/http/pprof on the given
+  address while sketch runs, and -cpuprofile and -memprofile write a CPU
+  profile of the whole run and a heap profile at its end, for go tool pprof.
+
+  The -errmap flag writes a heatmap of the error between the canvas and the
+  source every -save interval, or every second without -save, numbered
+  like incremental saves, from black where they match through red and
+  yellow to white where they differ most, to show where sketching is
+  struggling, such as with -l too long for the detail.
+
+  The -compare flag writes an image of the source, the sketch and the
+  heatmap of -errmap side by side with each incremental save, numbered the
+  same, to share progress or show off what sketch does.
+
+  The -timelapse flag records the canvas every -save interval, or every
+  second without -save, and writes the snapshots as an animated GIF showing
+  the sketch emerging from the background.
+
+  The -video flag decodes frames straight from a video file by running ffmpeg
+  in the background, instead of reading numbered input files. Likewise, the
+  -encode flag pipes finished frames into ffmpeg as raw video and writes a
+  single encoded file instead of numbered output files.
+  The container and codec are chosen by ffmpeg from the file extension.
+
+  The -camera flag sketches what a camera sees, grabbing frames with ffmpeg
+  through V4L2 on Linux, AVFoundation on macOS or DirectShow on Windows, for
+  a live sketch mirror. Each frame is sketched in -iter iterations, starting
+  from the canvas of the one before as with -warm, and frames the camera
+  takes meanwhile are dropped for the latest, so the sketch keeps up
+  however slow it is. Pair it with -window or -preview to show it.
+
+  The -screen flag sketches the screen live in the same way, all of it or a
+  region given as WxH+X+Y, grabbed by ffmpeg -screen-fps times a second, for
+  abstract visualisations of whatever is on it.
+
+  -aa
+        draw anti-aliased lines
+  -adaptive
+        share iterations between frames by how far each starts from its source
+  -alpha opacity
+        opacity of strokes, from 1 to 255, blending them over the canvas (default 255)
+  -angles list
+        comma separated list of the only angles, in degrees anticlockwise from horizontal, to draw lines at
+  -anneal
+        sometimes accept strokes that make the sketch worse, less often as it goes on
+  -anneal-cool factor
+        factor by which -anneal cools each iteration (default 0.99999)
+  -anneal-temp temperature
+        starting temperature of -anneal, the relative worsening accepted with odds 1 in e (default 0.05)
+  -bg colour
+        background colour: black, white, transparent, avg for the source's average, or #rrggbb[aa] (default "black")
+  -brush file
+        paint lines by stamping the brush tip image file along them
+  -camera device
+        sketch what camera device sees, e.g. /dev/video0, warm-starting each frame (requires ffmpeg)
+  -candidates number
+        number of candidates to score each iteration, trying the best (default 1)
+  -checkpoint file
+        periodically save the state of the run to file
+  -checkpoint-interval time
+        time between checkpoints (default 1m0s)
+  -climb n
+        mutate each candidate n times, keeping each mutation that scores better
+  -color mode
+        mode of colouring strokes: palette, start or mid for the source's colour there, avg or best (default "palette")
+  -colors n
+        reduce the palette to n representative colours (0 for all)
+  -compare
+        with each incremental save, write the source, sketch and error heatmap side by side
+  -control address
+        take changes to -l, -save, -alpha, -iter, -colors and -rate while running on address, or unix:path
+  -coordinator address
+        hand frames out to workers, listening on address
+  -cpuprofile file
+        write a CPU profile to file
+  -crop rectangle
+        sketch only the rectangle x,y,w,h of each source, each in pixels or as a percentage
+  -crop-composite
+        write the -crop sketch over the whole source
+  -duotone colours
+        sketch the source in the ramp between two colours, dark and light, e.g. #1b2a4a,#f3e9d2
+  -duration limit
+        time limit for sketching each frame, e.g. 2m
+  -edges bias
+        bias of stroke placement toward edges in the source, from 0 for none to 1 for only edges
+  -encode file
+        encode output frames into video file (requires ffmpeg)
+  -errmap
+        write heatmaps of the error every -save interval, or every second without -save
+  -flow strength
+        strength, from 0 to 1, with which lines follow the contours of the source
+  -flow-cross
+        with -flow, turn lines across the contours instead
+  -focus bias
+        bias of stroke placement toward where the sketch is furthest from the source, from 0 for none to 1 for only by that
+  -format format
+        output image format: png, jpeg, webp, tiff or bmp (default "png")
+  -fps rate
+        frame rate of encoded video (default 25)
   -framelimit limit
         limit for total number of output frames
+  -generations number
+        number of generations to evolve the -genetic population for (default 5)
+  -genetic size
+        evolve a population of size candidates each iteration, trying the best (0 for none)
+  -gif file
+        assemble output frames into an animated GIF file
+  -gpu
+        score line candidates in batches on the GPU (requires OpenCL)
+  -gpu-batch number
+        number of candidates per GPU batch (default 4096)
+  -hatch passes
+        sketch a hatched drawing of the source in ink, with up to passes layers of hatching
+  -hatch-spacing pixels
+        pixels between the lines of a layer of hatching (default 4)
+  -in-pattern pattern
+        input file name pattern (default "input_%03d.png")
+  -init file
+        start each frame's canvas from the image file, scaled to fit
+  -ink colour
+        draw only in the colour black, white or #rrggbb, sketching the tones of the source in it
   -iter limit
         iteration limit (-1 for infinite) (default 5000000)
+  -jobs number
+        number of frames to sketch at once (default 1)
   -l length
-        line length limit (default 40)
+        line length limit, or a schedule such as 120:10 from the first iteration to the last (default "40")
+  -l-decay curve
+        curve of an -l schedule: linear or exp (default "linear")
+  -lease time
+        time a worker has to return each frame (default 10m0s)
+  -log-format format
+        log format: text or json (default "text")
+  -logfile file
+        append logs to file instead of writing them to standard error
+  -lossless
+        encode WebP losslessly
+  -mask file
+        only draw where the image file, scaled to fit, is light
+  -max-dim pixels
+        scale sources larger than this many pixels across or down to fit before sketching (0 for no limit)
+  -max-memory budget
+        keep within a budget of bytes, tiling frames too large to sketch whole (K, M or G for 2^10, 2^20 or 2^30)
+  -memprofile file
+        write a heap profile to file at the end of the run
+  -metric metric
+        colour difference metric: rgb, linear, lab or ssim (default "rgb")
+  -midi device
+        take changes to -l, -alpha, -colors and -rate while running as MIDI control changes from raw MIDI device
+  -ndi name
+        send the canvas as it is sketched as the NDI source name (requires -tags ndi)
+  -no-alpha
+        leave alpha out of the metric, as -weights with an alpha weight of 0
+  -osc address
+        take changes to -l, -alpha, -colors and -rate while running as OSC messages on UDP address
+  -out-pattern pattern
+        output file name pattern, without extension (default "frame_%03d")
+  -outdir directory
+        directory for output frames and incremental saves, created if needed
+  -overwrite
+        number output from 1, overwriting earlier output
   -p    remove duplicate colours from palette
+  -palette-from file
+        take the palette from the image file instead of the source
+  -palette-size pixels
+        most pixels to sample the palette from (default 4194304)
+  -plateau fraction
+        stop once the RMS error falls by less than this fraction of itself over -plateau-window iterations
+  -plateau-window iterations
+        iterations over which -plateau measures how fast the error falls (default 100000)
+  -pprof address
+        serve net/http/pprof on address, e.g. :6060
+  -preview address
+        serve a page showing the canvas as it is sketched on address, e.g. :8081
+  -pyramid levels
+        sketch coarse to fine, in levels of half the size of the one after (default 1)
+  -q    only log warnings and errors
+  -quality quality
+        JPEG and WebP quality, from 1 to 100 (default 90)
+  -quiet
+        don't log progress every -stat interval
+  -rate iterations
+        most iterations a second, to slow sketching down to watch (0 for no limit)
+  -report
+        log the PSNR and SSIM of the sketch to the source at each save
+  -residual n
+        place strokes in proportion to the error at each pixel, as of every n iterations (0 for never)
+  -restart-jobs number
+        number of -restarts of a frame to sketch at once (default 1)
+  -restarts n
+        sketch each frame n times, seeded differently, keeping the closest to the source (default 1)
+  -restarts-out
+        also write the sketches of -restarts not kept
+  -resume file
+        carry on from the checkpoint file
+  -rtmp url
+        stream the canvas as it is sketched to the RTMP server at url (requires ffmpeg)
   -save interval
         incremental save interval, in seconds (default -1)
+  -scene-cut float
+        with -warm, the difference between frames, from 0 to 1, that starts a blank canvas (default 0.15)
+  -screen region
+        sketch the screen live, all of it or the region WxH+X+Y (requires ffmpeg)
+  -screen-fps frames
+        frames a second to grab from the screen with -screen (default 10)
+  -seed seed
+        random number generator seed, or "random" to pick one (default "1234")
+  -shape shape
+        shape to draw with: line, curve, polyline, rect, circle, ellipse, triangle or stipple (default "line")
   -start int
         starting frame number (default 1)
   -stat interval
         statistics reporting interval, in seconds (default 1)
+  -stats-file file
+        append statistics to CSV file, a row each
+  -stats-format format
+        statistics format: text to log them, or json for a line of JSON each to standard output or -stats-out (default "text")
+  -stats-out file
+        write -stats-format json to file instead of standard output
+  -strokelog file
+        append accepted strokes to JSON lines file
+  -strokes limit
+        limit for accepted strokes per frame
+  -svg file
+        write accepted strokes as SVG to file (may contain %d for the frame number)
+  -target error
+        stop once the RMS error per channel, from 0 to 1, drops below this
+  -term-preview protocol
+        draw the canvas in the terminal every -stat interval, with protocol kitty, iterm2, sixel or auto
+  -tile-jobs number
+        number of -tiles of a frame to sketch at once (default 1)
+  -tile-overlap pixels
+        pixels by which -tiles overlap, blended across to hide the seams (default 32)
+  -tiles size
+        sketch each frame in overlapping tiles of size pixels square, stitched together (0 for none)
+  -timelapse file
+        write an animated GIF file of the canvas at each save interval
+  -v    log in more detail
+  -video file
+        read input frames from video file (requires ffmpeg)
+  -warm
+        start each frame from the sketch of the one before
+  -watch directory
+        sketch each image file that appears in directory into -outdir, until interrupted
+  -weight file
+        favour the light parts of the image file, scaled to fit, when placing and scoring strokes
+  -weights weights
+        weights of the channels in the metric, r,g,b,a or l,a,b,alpha (default "1,1,1,1")
+  -width width
+        line width in pixels, or a range such as 2-5 to pick from at random (default "1")
+  -window
+        show the canvas in a window as it is sketched (requires -tags window)
+  -worker url
+        sketch frames for the coordinator at url
 */
 package main
 
-import (
-	"flag"
-	"fmt"
-	"github.com/StephaneBunel/bresenham"
-	"image"
-	"image/color"
-	"image/draw"
-	_ "image/gif"
-	_ "image/jpeg"
-	"image/png"
-	"log"
-	"math"
-	"math/rand"
-	"os"
-	"time"
-)
-
-func bdiff(a, b image.Image, x1, y1, x2, y2 int) float64 {
-	var dx, dy, e, slope int
-	var dif float64
-
-	if x1 > x2 {
-		x1, y1, x2, y2 = x2, y2, x1, y1
-	}
-
-	dx, dy = x2-x1, y2-y1
-	if dy < 0 {
-		dy = -dy
-	}
-
-	switch {
-	case x1 == x2 && y1 == y2:
-		dif += calcdiff(a, b, x1, y1)
-	case y1 == y2:
-		for ; dx != 0; dx-- {
-			dif += calcdiff(a, b, x1, y1)
-			x1++
-		}
-		dif += calcdiff(a, b, x1, y1)
-	case x1 == x2:
-		if y1 > y2 {
-			y1, y2 = y2, y1
-		}
-		for ; dy != 0; dy-- {
-			dif += calcdiff(a, b, x1, y1)
-			y1++
-		}
-		dif += calcdiff(a, b, x1, y1)
-	case dx == dy:
-		if y1 < y2 {
-			for ; dx != 0; dx-- {
-				dif += calcdiff(a, b, x1, y1)
-				x1++
-				y1++
-			}
-		} else {
-			for ; dx != 0; dx-- {
-				dif += calcdiff(a, b, x1, y1)
-				x1++
-				y1--
-			}
-		}
-		dif += calcdiff(a, b, x1, y1)
-	case dx > dy:
-		if y1 < y2 {
-			dy, e, slope = 2*dy, dx, 2*dx
-			for ; dx != 0; dx-- {
-				dif += calcdiff(a, b, x1, y1)
-				x1++
-				e -= dy
-				if e < 0 {
-					y1++
-					e += slope
-				}
-			}
-		} else {
-			dy, e, slope = 2*dy, dx, 2*dx
-			for ; dx != 0; dx-- {
-				dif += calcdiff(a, b, x1, y1)
-				x1++
-				e -= dy
-				if e < 0 {
-					y1--
-					e += slope
-				}
-			}
-		}
-		dif += calcdiff(a, b, x2, y2)
-	default:
-		if y1 < y2 {
-			dx, e, slope = 2*dx, dy, 2*dy
-			for ; dy != 0; dy-- {
-				dif += calcdiff(a, b, x1, y1)
-				y1++
-				e -= dx
-				if e < 0 {
-					x1++
-					e += slope
-				}
-			}
-		} else {
-			dx, e, slope = 2*dx, dy, 2*dy
-			for ; dy != 0; dy-- {
-				dif += calcdiff(a, b, x1, y1)
-				y1--
-				e -= dx
-				if e < 0 {
-					x1++
-					e += slope
-				}
-			}
-		}
-		dif += calcdiff(a, b, x2, y2)
-	}
-	return dif
-}
-
-func calcdiff(a, b image.Image, x, y int) float64 {
-	aR, aG, aB, aA := a.At(x, y).RGBA()
-	bR, bG, bB, bA := b.At(x, y).RGBA()
-	ra := float64(aR)
-	rb := float64(bR)
-	ga := float64(aG)
-	gb := float64(bG)
-	ba := float64(aB)
-	bb := float64(bB)
-	aa := float64(aA)
-	ab := float64(bA)
-	R := (rb - ra) * (rb - ra)
-	G := (gb - ga) * (gb - ga)
-	B := (bb - ba) * (bb - ba)
-	A := (ab - aa) * (ab - aa)
-	return math.Sqrt(R + G + B + A)
-}
-
-func bcopy(img, src *image.RGBA, x1, y1, x2, y2 int) {
-	var dx, dy, e, slope int
-
-	if x1 > x2 {
-		x1, y1, x2, y2 = x2, y2, x1, y1
-	}
-
-	dx, dy = x2-x1, y2-y1
-	if dy < 0 {
-		dy = -dy
-	}
-
-	switch {
-	case x1 == x2 && y1 == y2:
-		img.Set(x1, y1, src.At(x1, y1))
-	case y1 == y2:
-		for ; dx != 0; dx-- {
-			img.Set(x1, y1, src.At(x1, y1))
-			x1++
-		}
-		img.Set(x1, y1, src.At(x1, y1))
-	case x1 == x2:
-		if y1 > y2 {
-			y1, y2 = y2, y1
-		}
-		for ; dy != 0; dy-- {
-			img.Set(x1, y1, src.At(x1, y1))
-			y1++
-		}
-		img.Set(x1, y1, src.At(x1, y1))
-	case dx == dy:
-		if y1 < y2 {
-			for ; dx != 0; dx-- {
-				img.Set(x1, y1, src.At(x1, y1))
-				x1++
-				y1++
-			}
-		} else {
-			for ; dx != 0; dx-- {
-				img.Set(x1, y1, src.At(x1, y1))
-				x1++
-				y1--
-			}
-		}
-		img.Set(x1, y1, src.At(x1, y1))
-	case dx > dy:
-		if y1 < y2 {
-			dy, e, slope = 2*dy, dx, 2*dx
-			for ; dx != 0; dx-- {
-				img.Set(x1, y1, src.At(x1, y1))
-				x1++
-				e -= dy
-				if e < 0 {
-					y1++
-					e += slope
-				}
-			}
-		} else {
-			dy, e, slope = 2*dy, dx, 2*dx
-			for ; dx != 0; dx-- {
-				img.Set(x1, y1, src.At(x1, y1))
-				x1++
-				e -= dy
-				if e < 0 {
-					y1--
-					e += slope
-				}
-			}
-		}
-		img.Set(x2, y2, src.At(x2, y2))
-	default:
-		if y1 < y2 {
-			dx, e, slope = 2*dx, dy, 2*dy
-			for ; dy != 0; dy-- {
-				img.Set(x1, y1, src.At(x1, y1))
-				y1++
-				e -= dx
-				if e < 0 {
-					x1++
-					e += slope
-				}
-			}
-		} else {
-			dx, e, slope = 2*dx, dy, 2*dy
-			for ; dy != 0; dy-- {
-				img.Set(x1, y1, src.At(x1, y1))
-				y1--
-				e -= dx
-				if e < 0 {
-					x1++
-					e += slope
-				}
-			}
-		}
-		img.Set(x2, y2, src.At(x2, y2))
-	}
-}
-
-func save(img image.Image, name string) {
-	name = fmt.Sprintf("%s.png", name)
-	outf, err := os.Create(name)
-	if err != nil {
-		log.Fatalln(err)
-	}
-	defer outf.Close()
-	png.Encode(outf, img)
-	log.Println("wrote", name)
-}
-
-var iterLimit int
-var frameStart int
-var frameLimit int
-var lineLen int
-var palletize bool
-var saveInterval float64
-var statInterval float64
-
-func init() {
-	flag.IntVar(&iterLimit, "iter", 5000000, "iteration `limit` (-1 for infinite)")
-	flag.IntVar(&frameStart, "start", 1, "starting frame number")
-	flag.IntVar(&frameLimit, "framelimit", 0, "`limit` for total number of output frames")
-	flag.IntVar(&lineLen, "l", 40, "line `length` limit")
-	flag.BoolVar(&palletize, "p", false, "remove duplicate colours from palette")
-	flag.Float64Var(&saveInterval, "save", -1.0, "save `interval`, in seconds")
-	flag.Float64Var(&statInterval, "stat", 1.0, "statistics reporting `interval`, in seconds")
-}
-
-var incrSaveNum = 1 // when saving incrementally
-var saveNum = 1     // when saving finished frames
-
-func sketch(src image.Image) {
-	w := src.Bounds().Dx()
-	h := src.Bounds().Dy()
-
-	img := image.NewRGBA(src.Bounds())
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			clr := src.At(x, y)
-			clr = color.RGBAModel.Convert(clr)
-			img.Set(x, y, clr)
-		}
-	}
-
-	palette := make([]color.Color, 0, 600000)
-	palettemap := make(map[color.Color]bool, 600000)
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			if palletize {
-				if _, ok := palettemap[img.At(x, y)]; !ok {
-					palette = append(palette, img.At(x, y))
-					palettemap[img.At(x, y)] = true
-				}
-			} else {
-				palette = append(palette, img.At(x, y))
-			}
-		}
-	}
-	log.Printf("%d colours in palette\n", len(palette))
-
-	img1 := image.NewRGBA(img.Bounds())
-	img2 := image.NewRGBA(img.Bounds())
-	bg := color.RGBA{0, 0, 0, 255}
-	draw.Draw(img1, img1.Bounds(), &image.Uniform{bg}, image.ZP, draw.Src)
-	draw.Draw(img2, img2.Bounds(), &image.Uniform{bg}, image.ZP, draw.Src)
-
-	var lastSaveTime = time.Now()
-	var lastStatTime = time.Now()
-	var stati int
-	var statc int
-
-	for i := 0; i < iterLimit || iterLimit < 0; i++ {
-		stati++
-		x1 := rand.Intn(w)
-		y1 := rand.Intn(h)
-		x2 := -lineLen/2 + x1 + rand.Intn(lineLen)
-		y2 := -lineLen/2 + y1 + rand.Intn(lineLen)
-		//x2 := x1 + lineLen + rand.Intn(10)
-		//y2 := y1 + lineLen/2 + rand.Intn(10)
-		clr := palette[rand.Intn(len(palette))]
-
-		bresenham.Bresenham(img1, x1, y1, x2, y2, clr)
-
-		if bdiff(img, img1, x1, y1, x2, y2) < bdiff(img, img2, x1, y1, x2, y2) {
-			// converges
-			bcopy(img2, img1, x1, y1, x2, y2)
-			statc++
-		} else {
-			// diverges
-			bcopy(img1, img2, x1, y1, x2, y2)
-		}
-		if i%50 == 0 { // don't smash that time.Now()
-			now := time.Now()
-			dur := now.Sub(lastSaveTime)
-			if saveInterval > 0 && dur >= time.Duration(saveInterval)*time.Second {
-				save(img2, fmt.Sprintf("incr_%03d", incrSaveNum))
-				incrSaveNum++
-				lastSaveTime = now
-			}
-			dur = now.Sub(lastStatTime)
-			if dur >= time.Duration(statInterval)*time.Second {
-				ips := float64(stati) / dur.Seconds()
-				cps := float64(statc) / dur.Seconds()
-				log.Printf("%8d iters %10.2f iter/s %9.2f converg/s %6.2f%% c/i\n", i, ips, cps, 100*cps/ips)
-				stati = 0
-				statc = 0
-				lastStatTime = now
-			}
-		}
-	}
-
-	save(img2, fmt.Sprintf("frame_%03d", saveNum))
-	saveNum++
-}
+import "github.com/Hypeouseaus/sketchfy/sketch"
 
 func main() {
-	log.SetFlags(0)
-	rand.Seed(1234)
-	flag.Parse()
-	//if flag.NArg() != 1 {
-	//	log.Fatalln("usage: sketch [-iter -l -p -save -stat] [file]")
-	//}
-
-	frameNum := frameStart
-
-	for {
-		if frameLimit > 1 && frameNum-frameStart > frameLimit {
-			break
-		}
-		log.Println(fmt.Sprintf("looking for input_%03d.png", frameNum))
-		f, err := os.Open(fmt.Sprintf("input_%03d.png", frameNum))
-		frameNum++
-		if err != nil {
-			break
-			//log.Fatalln(err)
-		}
-		src, _, err := image.Decode(f)
-		if err != nil {
-			log.Fatalln(err)
-		}
-		f.Close()
-
-		sketch(src)
-	}
-	log.Println("end of frames")
-}
\ No newline at end of file
+	sketch.Main()
+}
@@ -0,0 +1,71 @@
+// Package mobile is the interface of sketch for Android and iOS apps, bound
+// with gomobile, once go get golang.org/x/mobile/bind has added what the
+// bindings need to go.mod:
+//
+//	gomobile bind -target android github.com/Hypeouseaus/sketchfy/mobile
+//	gomobile bind -target ios github.com/Hypeouseaus/sketchfy/mobile
+//
+// Images go in as the bytes of an image file, such as the JPEG of a camera
+// photo, and come out as PNG, and nothing is read from or written to files.
+// Flags are set with SetFlag, as they would be on the command line, for the
+// sketches started after them. Those that write files, such as -save and
+// -svg, shouldn't be set.
+package mobile
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+
+	"github.com/Hypeouseaus/sketchfy/sketch"
+)
+
+// A Progress is told how a sketch is going, every -stat interval.
+type Progress interface {
+	// Progress is called with the iterations done, and the canvas as PNG.
+	Progress(iters int, canvas []byte)
+}
+
+// SetFlag sets the flag name to value, returning an error if the flags
+// can't be sketched with as they now are, which Sketch will return too.
+func SetFlag(name, value string) error {
+	return sketch.SetFlag(name, value)
+}
+
+// Sketch sketches the image file data, for iters iterations or as -iter says
+// if 0, and returns the sketch as PNG. progress may be nil.
+func Sketch(data []byte, iters int, progress Progress) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var report func(int, *image.RGBA)
+	if progress != nil {
+		report = func(iters int, canvas *image.RGBA) {
+			if b, err := encodePNG(canvas); err == nil {
+				progress.Progress(iters, b)
+			}
+		}
+	}
+	out, err := sketch.Sketch(img, iters, report)
+	if err != nil {
+		return nil, err
+	}
+	return encodePNG(out)
+}
+
+// Stop stops the sketch in progress, if there is one, which then returns
+// the sketch as it is. Sketches run one at a time.
+func Stop() {
+	sketch.Stop()
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
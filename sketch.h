@@ -0,0 +1,51 @@
+/*
+ * The C interface of sketch, built as a shared library with
+ *
+ *	go build -tags cshared -buildmode=c-shared -o libsketch.so
+ *
+ * Images are w by h pixels of 8 bit RGBA, not premultiplied, row after row
+ * with no padding. Errors are logged to standard error. Flags apply to the
+ * sketches started after they are set, and mustn't be set while any is in
+ * progress.
+ */
+
+#ifndef SKETCH_H
+#define SKETCH_H
+
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/* SketchSetFlag sets a command line flag, such as "shape" to "curve".
+ * It returns 0, or -1 if the value is bad, or if the flags are then out of
+ * bounds or don't go together, as sketch would refuse to run with them. A
+ * value that is only out of bounds is still set, and sketches fail until
+ * the flags are set right. */
+int SketchSetFlag(const char *name, const char *value);
+
+/* SketchImage sketches the image at rgba in iters iterations, or -iter if
+ * iters is 0, and writes the sketch to out, which has room for w*h*4 bytes.
+ * It returns 0, or -1 on an error, such as bad flags or a file they name
+ * that can't be read. */
+int SketchImage(const uint8_t *rgba, int w, int h, int iters, uint8_t *out);
+
+/* SketchNew starts sketching the image at rgba a step at a time, and
+ * returns a handle to it, or -1 on an error. Without a -iter of -1, the
+ * sketch still finishes after -iter iterations in all. */
+int SketchNew(const uint8_t *rgba, int w, int h);
+
+/* SketchStep sketches n more iterations, and writes the canvas to out if
+ * it isn't NULL. It returns 1 if there are more to do, 0 once the sketch
+ * is finished, or -1 on an error. */
+int SketchStep(int handle, int n, uint8_t *out);
+
+/* SketchFree stops a sketch started with SketchNew and frees it. */
+void SketchFree(int handle);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
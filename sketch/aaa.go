@@ -0,0 +1,2079 @@
+// Package sketch is the core of the sketch command, with its flags, which
+// are documented with the command. It can also be used as a library, with
+// SetFlag and Sketch, to sketch images in memory, as the mobile package does.
+package sketch
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	xdraw "golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"io"
+	"log"
+	"log/slog"
+	"math"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+func bdiff(a *plane, b color.RGBA, x1, y1, x2, y2 int) float64 {
+	var dx, dy, e, slope int
+	d := newDistAcc(a, b)
+
+	if x1 > x2 {
+		x1, y1, x2, y2 = x2, y2, x1, y1
+	}
+
+	dx, dy = x2-x1, y2-y1
+	if dy < 0 {
+		dy = -dy
+	}
+
+	switch {
+	case x1 == x2 && y1 == y2:
+		d.add(x1, y1)
+	case y1 == y2:
+		for ; dx != 0; dx-- {
+			d.add(x1, y1)
+			x1++
+		}
+		d.add(x1, y1)
+	case x1 == x2:
+		if y1 > y2 {
+			y1, y2 = y2, y1
+		}
+		for ; dy != 0; dy-- {
+			d.add(x1, y1)
+			y1++
+		}
+		d.add(x1, y1)
+	case dx == dy:
+		if y1 < y2 {
+			for ; dx != 0; dx-- {
+				d.add(x1, y1)
+				x1++
+				y1++
+			}
+		} else {
+			for ; dx != 0; dx-- {
+				d.add(x1, y1)
+				x1++
+				y1--
+			}
+		}
+		d.add(x1, y1)
+	case dx > dy:
+		if y1 < y2 {
+			dy, e, slope = 2*dy, dx, 2*dx
+			for ; dx != 0; dx-- {
+				d.add(x1, y1)
+				x1++
+				e -= dy
+				if e < 0 {
+					y1++
+					e += slope
+				}
+			}
+		} else {
+			dy, e, slope = 2*dy, dx, 2*dx
+			for ; dx != 0; dx-- {
+				d.add(x1, y1)
+				x1++
+				e -= dy
+				if e < 0 {
+					y1--
+					e += slope
+				}
+			}
+		}
+		d.add(x2, y2)
+	default:
+		if y1 < y2 {
+			dx, e, slope = 2*dx, dy, 2*dy
+			for ; dy != 0; dy-- {
+				d.add(x1, y1)
+				y1++
+				e -= dx
+				if e < 0 {
+					x1++
+					e += slope
+				}
+			}
+		} else {
+			dx, e, slope = 2*dx, dy, 2*dy
+			for ; dy != 0; dy-- {
+				d.add(x1, y1)
+				y1--
+				e -= dx
+				if e < 0 {
+					x1++
+					e += slope
+				}
+			}
+		}
+		d.add(x2, y2)
+	}
+	return d.total()
+}
+
+// calcdiff returns the distance at (x, y) between a and a colour with the
+// samples s, from colorSamples.
+func calcdiff(a *plane, s *[4]float64, x, y int) float64 {
+	if !(image.Point{x, y}.In(a.Rect)) {
+		return 0
+	}
+	i := a.PixOffset(x, y)
+	return math.Sqrt(samplediff(a.Pix[i:i+4:i+4], s))
+}
+
+// pixdiff returns the squared distance between two RGBA pixels. It is the
+// reference implementation of planediff.
+func pixdiff(p, q []uint8) float64 {
+	R := float64((int(q[0]) - int(p[0])) * 0x101)
+	G := float64((int(q[1]) - int(p[1])) * 0x101)
+	B := float64((int(q[2]) - int(p[2])) * 0x101)
+	A := float64((int(q[3]) - int(p[3])) * 0x101)
+	return R*R + G*G + B*B + A*A
+}
+
+// bline calls plot for each pixel on the line from (x1, y1) to (x2, y2),
+// visiting the same pixels as bdiff.
+func bline(x1, y1, x2, y2 int, plot func(x, y int)) {
+	var dx, dy, e, slope int
+
+	if x1 > x2 {
+		x1, y1, x2, y2 = x2, y2, x1, y1
+	}
+
+	dx, dy = x2-x1, y2-y1
+	if dy < 0 {
+		dy = -dy
+	}
+
+	switch {
+	case x1 == x2 && y1 == y2:
+		plot(x1, y1)
+	case y1 == y2:
+		for ; dx != 0; dx-- {
+			plot(x1, y1)
+			x1++
+		}
+		plot(x1, y1)
+	case x1 == x2:
+		if y1 > y2 {
+			y1, y2 = y2, y1
+		}
+		for ; dy != 0; dy-- {
+			plot(x1, y1)
+			y1++
+		}
+		plot(x1, y1)
+	case dx == dy:
+		if y1 < y2 {
+			for ; dx != 0; dx-- {
+				plot(x1, y1)
+				x1++
+				y1++
+			}
+		} else {
+			for ; dx != 0; dx-- {
+				plot(x1, y1)
+				x1++
+				y1--
+			}
+		}
+		plot(x1, y1)
+	case dx > dy:
+		if y1 < y2 {
+			dy, e, slope = 2*dy, dx, 2*dx
+			for ; dx != 0; dx-- {
+				plot(x1, y1)
+				x1++
+				e -= dy
+				if e < 0 {
+					y1++
+					e += slope
+				}
+			}
+		} else {
+			dy, e, slope = 2*dy, dx, 2*dx
+			for ; dx != 0; dx-- {
+				plot(x1, y1)
+				x1++
+				e -= dy
+				if e < 0 {
+					y1--
+					e += slope
+				}
+			}
+		}
+		plot(x2, y2)
+	default:
+		if y1 < y2 {
+			dx, e, slope = 2*dx, dy, 2*dy
+			for ; dy != 0; dy-- {
+				plot(x1, y1)
+				y1++
+				e -= dx
+				if e < 0 {
+					x1++
+					e += slope
+				}
+			}
+		} else {
+			dx, e, slope = 2*dx, dy, 2*dy
+			for ; dy != 0; dy-- {
+				plot(x1, y1)
+				y1--
+				e -= dx
+				if e < 0 {
+					x1++
+					e += slope
+				}
+			}
+		}
+		plot(x2, y2)
+	}
+}
+
+func save(img image.Image, name string) {
+	name = outPath(fmt.Sprintf("%s.%s", name, formatExt[format]))
+	if err := writeImage(name, img); err != nil {
+		log.Fatalln(err)
+	}
+	slog.Info("wrote", "file", name)
+}
+
+var iterLimit int
+var frameStart int
+var frameLimit int
+var lineLen int
+var lineFlag string
+var lineDecay string
+var palletize bool
+var numColors int
+var iterRate float64
+var paletteSize int
+var saveInterval float64
+var statInterval float64
+var statsFormat string
+var statsOutFile string
+var statsCSVFile string
+var pprofAddr string
+var cpuProfile string
+var memProfile string
+var verbose bool
+var quietLogs bool
+var logFormat string
+var quiet bool
+var logFile string
+var listenAddr string
+var previewAddr string
+var grpcAddr string
+var controlAddr string
+var oscAddr string
+var midiDevice string
+var watchDir string
+var showWindow bool
+var termPreview string
+var ndiName string
+var rtmpURL string
+var videoFile string
+var cameraDevice string
+var screenRegion string
+var screenRate float64
+var encodeFile string
+var fps float64
+var gifFile string
+var timelapseFile string
+var format string
+var quality int
+var webpLossless bool
+var seedFlag string
+var svgFile string
+var strokeLogFile string
+var shapeKind string
+var targetErr float64
+var plateau float64
+var plateauWindow int
+var pyramidLevels int
+var tileSize int
+var tileOverlap int
+var tileJobs int
+var maxDim int
+var memoryFlag string
+var cropFlag string
+var cropComposite bool
+var numRestarts int
+var restartJobs int
+var restartsOut bool
+var numCandidates int
+var populationSize int
+var generations int
+var climbSteps int
+var anneal bool
+var annealTemp float64
+var annealCool float64
+var duration time.Duration
+var strokeLimit int
+var inPattern string
+var outPattern string
+var outDir string
+var useGPU bool
+var gpuBatchSize int
+var numJobs int
+var coordinatorAddr string
+var workerURL string
+var lease time.Duration
+var checkpointFile string
+var checkpointInterval time.Duration
+var resumeFile string
+var overwrite bool
+var warmStart bool
+var sceneCut float64
+var adaptive bool
+var bgFlag string
+var initFile string
+var maskFile string
+var weightFile string
+var edgeBias float64
+var focusBias float64
+var residualEvery int
+var flowStrength float64
+var flowCross bool
+var anglesFlag string
+var hatchPasses int
+var hatchSpacing int
+var inkFlag string
+var duotoneFlag string
+var widthFlag string
+var antialias bool
+var strokeAlpha int
+var brushFile string
+var colorMode string
+var paletteFile string
+var metricName string
+var weightsFlag string
+var noAlpha bool
+var reportQuality bool
+var errmapOutput bool
+var compareOutput bool
+
+func init() {
+	flag.IntVar(&iterLimit, "iter", 5000000, "iteration `limit` (-1 for infinite)")
+	flag.StringVar(&cropFlag, "crop", "", "sketch only the `rectangle` x,y,w,h of each source, each in pixels or as a percentage")
+	flag.BoolVar(&cropComposite, "crop-composite", false, "write the -crop sketch over the whole source")
+	flag.IntVar(&maxDim, "max-dim", 0, "scale sources larger than this many `pixels` across or down to fit before sketching (0 for no limit)")
+	flag.IntVar(&frameStart, "start", 1, "starting frame number")
+	flag.StringVar(&inPattern, "in-pattern", "input_%03d.png", "input file name `pattern`")
+	flag.StringVar(&outDir, "outdir", "", "`directory` for output frames and incremental saves, created if needed")
+	flag.StringVar(&format, "format", "png", "output image `format`: png, jpeg, webp, tiff or bmp")
+	flag.IntVar(&quality, "quality", 90, "JPEG and WebP `quality`, from 1 to 100")
+	flag.BoolVar(&webpLossless, "lossless", false, "encode WebP losslessly")
+	flag.StringVar(&outPattern, "out-pattern", "frame_%03d", "output file name `pattern`, without extension")
+	flag.Float64Var(&targetErr, "target", 0, "stop once the RMS `error` per channel, from 0 to 1, drops below this")
+	flag.IntVar(&numRestarts, "restarts", 1, "sketch each frame `n` times, seeded differently, keeping the closest to the source")
+	flag.IntVar(&restartJobs, "restart-jobs", 1, "`number` of -restarts of a frame to sketch at once")
+	flag.BoolVar(&restartsOut, "restarts-out", false, "also write the sketches of -restarts not kept")
+	flag.IntVar(&tileSize, "tiles", 0, "sketch each frame in overlapping tiles of `size` pixels square, stitched together (0 for none)")
+	flag.IntVar(&tileOverlap, "tile-overlap", 32, "`pixels` by which -tiles overlap, blended across to hide the seams")
+	flag.IntVar(&tileJobs, "tile-jobs", 1, "`number` of -tiles of a frame to sketch at once")
+	flag.StringVar(&memoryFlag, "max-memory", "", "keep within a `budget` of bytes, tiling frames too large to sketch whole (K, M or G for 2^10, 2^20 or 2^30)")
+	flag.IntVar(&pyramidLevels, "pyramid", 1, "sketch coarse to fine, in `levels` of half the size of the one after")
+	flag.IntVar(&populationSize, "genetic", 0, "evolve a population of `size` candidates each iteration, trying the best (0 for none)")
+	flag.IntVar(&generations, "generations", 5, "`number` of generations to evolve the -genetic population for")
+	flag.IntVar(&numCandidates, "candidates", 1, "`number` of candidates to score each iteration, trying the best")
+	flag.IntVar(&climbSteps, "climb", 0, "mutate each candidate `n` times, keeping each mutation that scores better")
+	flag.BoolVar(&anneal, "anneal", false, "sometimes accept strokes that make the sketch worse, less often as it goes on")
+	flag.Float64Var(&annealTemp, "anneal-temp", 0.05, "starting `temperature` of -anneal, the relative worsening accepted with odds 1 in e")
+	flag.Float64Var(&annealCool, "anneal-cool", 0.99999, "`factor` by which -anneal cools each iteration")
+	flag.Float64Var(&plateau, "plateau", 0, "stop once the RMS error falls by less than this `fraction` of itself over -plateau-window iterations")
+	flag.IntVar(&plateauWindow, "plateau-window", 100000, "`iterations` over which -plateau measures how fast the error falls")
+	flag.DurationVar(&duration, "duration", 0, "time `limit` for sketching each frame, e.g. 2m")
+	flag.IntVar(&strokeLimit, "strokes", 0, "`limit` for accepted strokes per frame")
+	flag.IntVar(&frameLimit, "framelimit", 0, "`limit` for total number of output frames")
+	flag.StringVar(&lineFlag, "l", "40", "line `length` limit, or a schedule such as 120:10 from the first iteration to the last")
+	flag.StringVar(&lineDecay, "l-decay", "linear", "`curve` of an -l schedule: linear or exp")
+	flag.StringVar(&shapeKind, "shape", "line", "`shape` to draw with: line, curve, polyline, rect, circle, ellipse, triangle or stipple")
+	flag.BoolVar(&palletize, "p", false, "remove duplicate colours from palette")
+	flag.IntVar(&numColors, "colors", 0, "reduce the palette to `n` representative colours (0 for all)")
+	flag.Float64Var(&iterRate, "rate", 0, "most `iterations` a second, to slow sketching down to watch (0 for no limit)")
+	flag.IntVar(&paletteSize, "palette-size", 1<<22, "most `pixels` to sample the palette from")
+	flag.Float64Var(&saveInterval, "save", -1.0, "save `interval`, in seconds")
+	flag.Float64Var(&statInterval, "stat", 1.0, "statistics reporting `interval`, in seconds")
+	flag.StringVar(&statsFormat, "stats-format", "text", "statistics `format`: text to log them, or json for a line of JSON each to standard output or -stats-out")
+	flag.StringVar(&statsOutFile, "stats-out", "", "write -stats-format json to `file` instead of standard output")
+	flag.StringVar(&statsCSVFile, "stats-file", "", "append statistics to CSV `file`, a row each")
+	flag.StringVar(&pprofAddr, "pprof", "", "serve net/http/pprof on `address`, e.g. :6060")
+	flag.StringVar(&cpuProfile, "cpuprofile", "", "write a CPU profile to `file`")
+	flag.StringVar(&memProfile, "memprofile", "", "write a heap profile to `file` at the end of the run")
+	flag.BoolVar(&verbose, "v", false, "log in more detail")
+	flag.BoolVar(&quietLogs, "q", false, "only log warnings and errors")
+	flag.StringVar(&logFormat, "log-format", "text", "log `format`: text or json")
+	flag.BoolVar(&quiet, "quiet", false, "don't log progress every -stat interval")
+	flag.BoolVar(&showWindow, "window", false, "show the canvas in a window as it is sketched (requires -tags window)")
+	flag.StringVar(&rtmpURL, "rtmp", "", "stream the canvas as it is sketched to the RTMP server at `url` (requires ffmpeg)")
+	flag.StringVar(&ndiName, "ndi", "", "send the canvas as it is sketched as the NDI source `name` (requires -tags ndi)")
+	flag.StringVar(&termPreview, "term-preview", "", "draw the canvas in the terminal every -stat interval, with `protocol` kitty, iterm2, sixel or auto")
+	flag.StringVar(&previewAddr, "preview", "", "serve a page showing the canvas as it is sketched on `address`, e.g. :8081")
+	flag.StringVar(&watchDir, "watch", "", "sketch each image file that appears in `directory` into -outdir, until interrupted")
+	flag.StringVar(&controlAddr, "control", "", "take changes to -l, -save, -alpha, -iter, -colors and -rate while running on `address`, or unix:path")
+	flag.StringVar(&oscAddr, "osc", "", "take changes to -l, -alpha, -colors and -rate while running as OSC messages on UDP `address`")
+	flag.StringVar(&midiDevice, "midi", "", "take changes to -l, -alpha, -colors and -rate while running as MIDI control changes from raw MIDI `device`")
+	flag.StringVar(&logFile, "logfile", "", "append logs to `file` instead of writing them to standard error")
+	flag.StringVar(&videoFile, "video", "", "read input frames from video `file` (requires ffmpeg)")
+	flag.StringVar(&screenRegion, "screen", "", "sketch the screen live, all of it or the `region` WxH+X+Y (requires ffmpeg)")
+	flag.Float64Var(&screenRate, "screen-fps", 10, "`frames` a second to grab from the screen with -screen")
+	flag.StringVar(&cameraDevice, "camera", "", "sketch what camera `device` sees, e.g. /dev/video0, warm-starting each frame (requires ffmpeg)")
+	flag.StringVar(&encodeFile, "encode", "", "encode output frames into video `file` (requires ffmpeg)")
+	flag.Float64Var(&fps, "fps", 25, "frame `rate` of encoded video")
+	flag.StringVar(&timelapseFile, "timelapse", "", "write an animated GIF `file` of the canvas at each save interval")
+	flag.StringVar(&gifFile, "gif", "", "assemble output frames into an animated GIF `file`")
+	flag.StringVar(&svgFile, "svg", "", "write accepted strokes as SVG to `file` (may contain %d for the frame number)")
+	flag.StringVar(&strokeLogFile, "strokelog", "", "append accepted strokes to JSON lines `file`")
+	flag.BoolVar(&useGPU, "gpu", false, "score line candidates in batches on the GPU (requires OpenCL)")
+	flag.IntVar(&gpuBatchSize, "gpu-batch", 4096, "`number` of candidates per GPU batch")
+	flag.IntVar(&numJobs, "jobs", 1, "`number` of frames to sketch at once")
+	flag.StringVar(&coordinatorAddr, "coordinator", "", "hand frames out to workers, listening on `address`")
+	flag.StringVar(&workerURL, "worker", "", "sketch frames for the coordinator at `url`")
+	flag.DurationVar(&lease, "lease", 10*time.Minute, "`time` a worker has to return each frame")
+	flag.StringVar(&checkpointFile, "checkpoint", "", "periodically save the state of the run to `file`")
+	flag.DurationVar(&checkpointInterval, "checkpoint-interval", time.Minute, "`time` between checkpoints")
+	flag.StringVar(&resumeFile, "resume", "", "carry on from the checkpoint `file`")
+	flag.BoolVar(&overwrite, "overwrite", false, "number output from 1, overwriting earlier output")
+	flag.BoolVar(&warmStart, "warm", false, "start each frame from the sketch of the one before")
+	flag.Float64Var(&sceneCut, "scene-cut", 0.15, "with -warm, the difference between frames, from 0 to 1, that starts a blank canvas")
+	flag.BoolVar(&adaptive, "adaptive", false, "share iterations between frames by how far each starts from its source")
+	flag.StringVar(&bgFlag, "bg", "black", "background `colour`: black, white, transparent, avg for the source's average, or #rrggbb[aa]")
+	flag.StringVar(&initFile, "init", "", "start each frame's canvas from the image `file`, scaled to fit")
+	flag.StringVar(&maskFile, "mask", "", "only draw where the image `file`, scaled to fit, is light")
+	flag.StringVar(&weightFile, "weight", "", "favour the light parts of the image `file`, scaled to fit, when placing and scoring strokes")
+	flag.Float64Var(&edgeBias, "edges", 0, "`bias` of stroke placement toward edges in the source, from 0 for none to 1 for only edges")
+	flag.Float64Var(&focusBias, "focus", 0, "`bias` of stroke placement toward where the sketch is furthest from the source, from 0 for none to 1 for only by that")
+	flag.IntVar(&residualEvery, "residual", 0, "place strokes in proportion to the error at each pixel, as of every `n` iterations (0 for never)")
+	flag.Float64Var(&flowStrength, "flow", 0, "`strength`, from 0 to 1, with which lines follow the contours of the source")
+	flag.BoolVar(&flowCross, "flow-cross", false, "with -flow, turn lines across the contours instead")
+	flag.StringVar(&anglesFlag, "angles", "", "comma separated `list` of the only angles, in degrees anticlockwise from horizontal, to draw lines at")
+	flag.IntVar(&hatchPasses, "hatch", 0, "sketch a hatched drawing of the source in ink, with up to `passes` layers of hatching")
+	flag.IntVar(&hatchSpacing, "hatch-spacing", 4, "`pixels` between the lines of a layer of hatching")
+	flag.StringVar(&inkFlag, "ink", "", "draw only in the `colour` black, white or #rrggbb, sketching the tones of the source in it")
+	flag.StringVar(&duotoneFlag, "duotone", "", "sketch the source in the ramp between two `colours`, dark and light, e.g. #1b2a4a,#f3e9d2")
+	flag.StringVar(&widthFlag, "width", "1", "line `width` in pixels, or a range such as 2-5 to pick from at random")
+	flag.BoolVar(&antialias, "aa", false, "draw anti-aliased lines")
+	flag.IntVar(&strokeAlpha, "alpha", 255, "`opacity` of strokes, from 1 to 255, blending them over the canvas")
+	flag.StringVar(&brushFile, "brush", "", "paint lines by stamping the brush tip image `file` along them")
+	flag.StringVar(&colorMode, "color", "palette", "`mode` of colouring strokes: palette, start or mid for the source's colour there, avg or best")
+	flag.StringVar(&paletteFile, "palette-from", "", "take the palette from the image `file` instead of the source")
+	flag.StringVar(&metricName, "metric", "rgb", "colour difference `metric`: rgb, linear, lab or ssim")
+	flag.StringVar(&weightsFlag, "weights", "1,1,1,1", "`weights` of the channels in the metric, r,g,b,a or l,a,b,alpha")
+	flag.BoolVar(&noAlpha, "no-alpha", false, "leave alpha out of the metric, as -weights with an alpha weight of 0")
+	flag.BoolVar(&reportQuality, "report", false, "log the PSNR and SSIM of the sketch to the source at each save")
+	flag.BoolVar(&errmapOutput, "errmap", false, "write heatmaps of the error every -save interval, or every second without -save")
+	flag.BoolVar(&compareOutput, "compare", false, "with each incremental save, write the source, sketch and error heatmap side by side")
+	flag.StringVar(&seedFlag, "seed", "1234", "random number generator `seed`, or \"random\" to pick one")
+}
+
+// background is the colour of a blank canvas, from -bg. With -bg avg,
+// bgAverage is set, and each frame has its source's average colour instead.
+var background = color.RGBA{0, 0, 0, 255}
+var bgAverage bool
+
+// initImage, maskImage, weightImage and paletteImage are the -init, -mask,
+// -weight and -palette-from images.
+var initImage image.Image
+var maskImage image.Image
+var weightImage image.Image
+var paletteImage *image.RGBA
+
+// lineAngles are the -angles, in radians.
+var lineAngles []float64
+
+// minWidth and maxWidth are the range of -width.
+var minWidth, maxWidth = 1, 1
+
+// timelapse collects canvases for -timelapse.
+var timelapse *gifSink
+
+// incrSaves counts incremental saves, which frames sketched at once share.
+var incrSaves atomic.Int32
+
+const incrPattern = "incr_%03d"
+
+// errmapSaves counts -errmap heatmaps, named by errmapPattern.
+var errmapSaves atomic.Int32
+
+const errmapPattern = "errmap_%03d"
+
+// comparePattern names -compare images, numbered like the incremental saves
+// they go with.
+const comparePattern = "compare_%03d"
+
+var saveNum = 1 // when saving finished frames
+
+func sketch(j *job) (*image.RGBA, []stroke) {
+	src, rng, logger := j.src, j.rng, j.logger
+	w := src.Bounds().Dx()
+	h := src.Bounds().Dy()
+
+	// The source is only read from, so one already in the form it is
+	// scored in isn't copied, which would take as much memory again.
+	img, ok := src.(*image.RGBA)
+	if !ok || img.Rect.Min != (image.Point{}) || img.Stride != 4*w {
+		img = image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+	}
+	if hatchPasses > 0 {
+		img = hatch(img, j.bg)
+	} else if inkFlag != "" {
+		img = inkTones(img, j.bg)
+	} else if duotoneFlag != "" {
+		img = duotoned(img)
+	}
+	srcp := newPlane(img)
+	var m *mask
+	if maskImage != nil {
+		m = newMask(maskImage, w, h)
+	}
+	var wm *weightMap
+	var placement []float64 // weights for placing shapes, if not uniform
+	if weightImage != nil {
+		wm = newWeightMap(weightImage, w, h)
+		if !slices.ContainsFunc(wm.weight, func(wt float64) bool { return wt > 0 }) {
+			log.Fatalln("the weight map is all black")
+		}
+		placement = slices.Clone(wm.weight)
+	}
+	if edgeBias > 0 {
+		if placement == nil {
+			placement = slices.Repeat([]float64{1}, w*h)
+		}
+		for i, e := range edgeMagnitude(img) {
+			placement[i] *= 1 - edgeBias + edgeBias*e
+		}
+	}
+	smp := uniformSampler(w, h)
+	if placement != nil {
+		smp = weightedSampler(placement, w, h)
+	}
+	if lineScheduled() {
+		lineLen = lineLenFrom
+	}
+	if flowStrength > 0 {
+		smp.flow = newFlowField(img, imax(lineLen/4, 1))
+	}
+
+	canvas := blankCanvas(img.Bounds(), j.bg)
+	if j.warm != nil && j.warm.Rect == canvas.Rect {
+		copy(canvas.Pix, j.warm.Pix)
+	} else {
+		j.warm, j.warmStrokes = nil, nil
+	}
+
+	newShape := shapes[shapeKind]
+	var strokes []stroke
+
+	var startTime = time.Now()
+	var lastSaveTime = startTime
+	var lastStatTime = startTime
+	var lastLapseTime = startTime
+	var lastErrmapTime = startTime
+	var lastCheckpointTime = startTime
+	var stati int
+	var statc int
+	var totalc int
+	lapseInterval := lapseEvery()
+	start := 0
+	if cp := j.resume; cp != nil {
+		if cp.Canvas.W != w || cp.Canvas.H != h {
+			log.Fatalln("checkpoint is for a frame of a different size")
+		}
+		copy(canvas.Pix, cp.Canvas.Pix)
+		for _, e := range cp.Strokes {
+			s, err := entryStroke(e)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			strokes = append(strokes, s)
+		}
+		start, totalc = cp.Iter+1, cp.Accepted
+		startTime = startTime.Add(-cp.Elapsed)
+		logger.Info("resuming", "iters", cp.Iter, "converged", cp.Accepted)
+	}
+	if timelapse != nil {
+		timelapse.add(canvas)
+	}
+	errs := newErrMap(srcp, canvas)
+	if j.resume != nil {
+		errs.sum = j.resume.ErrSum
+	}
+	// refreshResidual rebuilds the -residual table from the error map, times
+	// the placement weights, with none under the mask.
+	var residual []float64
+	var table aliasTable
+	refreshResidual := func() {
+		for i, d := range errs.dist {
+			switch {
+			case m != nil && m.at(i%w, i/w):
+				residual[i] = 0
+			case placement != nil:
+				residual[i] = d * placement[i]
+			default:
+				residual[i] = d
+			}
+		}
+		smp.alias = nil
+		if table.build(residual) {
+			smp.alias = &table
+		}
+	}
+	if residualEvery > 0 {
+		residual = make([]float64, w*h)
+	}
+	if focusBias > 0 {
+		// Error under the mask can't be drawn away, and counts for as
+		// little as -weight says elsewhere.
+		var k []float64
+		if m != nil || wm != nil {
+			k = make([]float64, w*h)
+			for i := range k {
+				x, y := i%w, i/w
+				switch {
+				case m != nil && m.at(x, y):
+				case wm != nil:
+					k[i] = wm.at(x, y)
+				default:
+					k[i] = 1
+				}
+			}
+		}
+		errs.tree = newErrTree(errs, k)
+		smp.tree, smp.focus = errs.tree, focusBias
+	}
+	// report logs how close the sketch is to the source, with -report.
+	report := func() {
+		if reportQuality {
+			logger.Info("quality", "psnr_db", math.Round(psnr(img, canvas)*100)/100, "ssim", math.Round(meanSSIM(img, canvas)*1e4)/1e4)
+		}
+	}
+	saveCheckpoint := func(i int) {
+		cp := j.sketchCheckpoint(i, totalc, time.Since(startTime), errs.sum, canvas, strokes)
+		if err := writeCheckpoint(cp); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	// A candidate is scored by comparing its distance from the source with
+	// the error map's, without drawing it. The plot functions are made once,
+	// as closures passed to Rasterize would otherwise be allocated on every
+	// iteration.
+	var clr color.RGBA
+	var old float64
+	sumOld := func(x, y int) { old += errs.at(x, y) }
+	if m != nil || wm != nil {
+		sumOld = func(x, y int) {
+			if m != nil && m.at(x, y) {
+				// A candidate touching a masked pixel can never beat -Inf.
+				old = math.Inf(-1)
+			}
+			if wm != nil {
+				old += wm.at(x, y) * errs.at(x, y)
+			} else {
+				old += errs.at(x, y)
+			}
+		}
+	}
+	// With -weight, candidates are scored pixel by pixel, weighted like old.
+	var neu float64
+	// clrs is clr converted by colorSamples, while a candidate is scored
+	// or drawn pixel by pixel.
+	var clrs [4]float64
+	sumNew := func(x, y int) { neu += wm.at(x, y) * calcdiff(srcp, &clrs, x, y) }
+	diff := func(s Shape) float64 { return s.Diff(srcp, clr) }
+	if wm != nil {
+		diff = func(s Shape) float64 {
+			neu = 0
+			clrs = colorSamples(clr)
+			s.Rasterize(sumNew)
+			return neu
+		}
+	}
+	paint := func(x, y int) {
+		if (image.Point{x, y}.In(canvas.Rect)) {
+			i := canvas.PixOffset(x, y)
+			p := canvas.Pix[i : i+4 : i+4]
+			p[0], p[1], p[2], p[3] = clr.R, clr.G, clr.B, clr.A
+			errs.set(x, y, samplediff(srcp.Pix[i:i+4:i+4], &clrs))
+		}
+	}
+	// With -aa, -alpha or -brush, candidates are blended over the canvas
+	// instead, covering each pixel by their -alpha opacity, times the
+	// fraction of it they cover with -aa or -brush, and scored by how the
+	// pixels would then look.
+	covered := antialias || brushTip != nil
+	blended := covered || strokeAlpha < 255
+	opacity := float64(strokeAlpha) / 255
+	scoreCover := func(x, y int, a float64) {
+		if !(image.Point{x, y}.In(canvas.Rect)) {
+			return
+		}
+		a *= opacity
+		if m != nil && m.at(x, y) {
+			old = math.Inf(-1)
+		}
+		k := 1.0
+		if wm != nil {
+			k = wm.at(x, y)
+		}
+		i := canvas.PixOffset(x, y)
+		old += k * errs.at(x, y)
+		neu += k * math.Sqrt(colordiff(srcp.Pix[i:i+4:i+4], blend(canvas.Pix[i:i+4:i+4], clr, a)))
+	}
+	paintCover := func(x, y int, a float64) {
+		if (image.Point{x, y}.In(canvas.Rect)) {
+			i := canvas.PixOffset(x, y)
+			c := blend(canvas.Pix[i:i+4:i+4], clr, a*opacity)
+			canvas.SetRGBA(x, y, c)
+			errs.set(x, y, colordiff(srcp.Pix[i:i+4:i+4], c))
+		}
+	}
+	coverPlot := scoreCover
+	rasterCover := func(x, y int) { coverPlot(x, y, 1) }
+	cover := func(s Shape, plot func(x, y int, a float64)) {
+		if cs, ok := s.(coverShape); ok && covered {
+			cs.Cover(plot)
+			return
+		}
+		coverPlot = plot
+		s.Rasterize(rasterCover)
+	}
+
+	// With -metric ssim, candidates are scored by the windows around them.
+	var ssim *ssimScorer
+	if metricName == "ssim" {
+		ssim = newSSIMScorer(img, canvas, m, wm)
+	}
+	ssimCover := func(x, y int, a float64) { ssim.add(x, y, a*opacity) }
+	ssimRaster := func(x, y int) { ssim.add(x, y, 1) }
+
+	// pick returns the colour to draw a candidate in, from a palette made
+	// by repalette with -color palette.
+	var pick func(s Shape) color.RGBA
+	var repalette func()
+	switch colorMode {
+	case "best":
+		// The colour that would leave the least squared error, weighted
+		// by each pixel's coverage and -weight, over the pixels it covers.
+		var sum [4]float64
+		var wsum float64
+		bestPlot := func(x, y int, a float64) {
+			if !(image.Point{x, y}.In(canvas.Rect)) {
+				return
+			}
+			a *= opacity
+			k := a
+			if wm != nil {
+				k *= wm.at(x, y)
+			}
+			i := canvas.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				p, s := float64(canvas.Pix[i+c]), float64(img.Pix[i+c])
+				sum[c] += k * (a*p + s - p)
+			}
+			wsum += k * a
+		}
+		bestRaster := func(x, y int) { bestPlot(x, y, 1) }
+		pick = func(s Shape) color.RGBA {
+			sum, wsum = [4]float64{}, 0
+			if blended {
+				cover(s, bestPlot)
+			} else {
+				s.Rasterize(bestRaster)
+			}
+			if wsum == 0 {
+				_, mid := shapePoints(s)
+				return pointColor(img, mid)
+			}
+			var v [4]uint8
+			for c := range v {
+				v[c] = uint8(math.Round(math.Max(0, math.Min(255, sum[c]/wsum))))
+			}
+			// Premultiplied colours can't exceed their alpha.
+			return color.RGBA{min(v[0], v[3]), min(v[1], v[3]), min(v[2], v[3]), v[3]}
+		}
+	case "avg":
+		var sum [4]int
+		var n int
+		avgPlot := func(x, y int) {
+			if (image.Point{x, y}.In(img.Rect)) {
+				i := img.PixOffset(x, y)
+				for c := 0; c < 4; c++ {
+					sum[c] += int(img.Pix[i+c])
+				}
+				n++
+			}
+		}
+		pick = func(s Shape) color.RGBA {
+			sum, n = [4]int{}, 0
+			s.Rasterize(avgPlot)
+			if n == 0 {
+				_, mid := shapePoints(s)
+				return pointColor(img, mid)
+			}
+			return color.RGBA{uint8((sum[0] + n/2) / n), uint8((sum[1] + n/2) / n), uint8((sum[2] + n/2) / n), uint8((sum[3] + n/2) / n)}
+		}
+	case "start", "mid":
+		mid := colorMode == "mid"
+		pick = func(s Shape) color.RGBA {
+			start, centre := shapePoints(s)
+			if mid {
+				return pointColor(img, centre)
+			}
+			return pointColor(img, start)
+		}
+	default:
+		var palette *colorPalette
+		repalette = func() {
+			if paletteImage != nil {
+				palette = newPalette(paletteImage, nil)
+			} else {
+				palette = newPalette(img, m)
+			}
+			if len(palette.colors) == 0 {
+				log.Fatalln("the mask leaves nothing to sketch")
+			}
+			if hatchPasses > 0 || inkFlag != "" {
+				palette = weightedPalette(map[color.RGBA]int{ink: 1})
+			}
+			logger.Debug("palette", "colours", len(palette.colors))
+		}
+		repalette()
+		pick = func(Shape) color.RGBA { return palette.pick(rng) }
+	}
+
+	// score sets old and neu to the error over the pixels shape covers
+	// without it and with it, in clr.
+	score := func(shape Shape) {
+		old = 0
+		if ssim != nil {
+			ssim.reset()
+			if blended {
+				cover(shape, ssimCover)
+			} else {
+				shape.Rasterize(ssimRaster)
+			}
+			old, neu = ssim.score(clr)
+		} else if blended {
+			neu = 0
+			cover(shape, scoreCover)
+		} else {
+			shape.Rasterize(sumOld)
+			neu = diff(shape)
+		}
+	}
+
+	var gpu *gpuScorer
+	var batch *gpuBatch
+	if useGPU && shapeKind == "line" && maxWidth == 1 && !antialias && strokeAlpha == 255 && brushTip == nil && metricName == "rgb" && !weighted {
+		var err error
+		if gpu, err = newGPUScorer(srcp, errs, gpuBatchSize); err != nil {
+			gpuWarning.Do(func() { slog.Warn("gpu unavailable, using the CPU", "err", err) })
+		} else {
+			defer gpu.close()
+			batch = newGPUBatch(gpuBatchSize)
+		}
+	}
+
+	// propose returns a new candidate, to be drawn in clr, with old and neu
+	// set by score.
+	propose := func() Shape {
+		var shape Shape
+		if gpu != nil {
+			var err error
+			if shape, clr, err = batch.propose(gpu, rng, smp, pick); err != nil {
+				log.Fatalln(err)
+			}
+		} else {
+			shape = newShape(rng, smp)
+			clr = pick(shape)
+		}
+		score(shape)
+		// With -climb, the candidate is mutated that many times, moving it
+		// or, from a palette, changing its colour, and each mutation that
+		// scores better is kept.
+		for k := 0; k < climbSteps; k++ {
+			wasClr, wasOld, wasNeu := clr, old, neu
+			t := cloneShape(shape)
+			if repalette != nil && rng.Intn(2) == 0 {
+				clr = pick(t)
+			} else {
+				t.Mutate(rng)
+				if repalette == nil {
+					clr = pick(t)
+				}
+			}
+			score(t)
+			if neu-old < wasNeu-wasOld {
+				shape = t
+			} else {
+				clr, old, neu = wasClr, wasOld, wasNeu
+			}
+		}
+		return shape
+	}
+
+	// breed returns a scored child of a and b for the -genetic population,
+	// pop.
+	var pop []member
+	breed := func(a, b member) member {
+		s := crossShapes(rng, a.shape, b.shape)
+		clr = a.clr
+		if rng.Intn(2) == 0 {
+			clr = b.clr
+		}
+		if rng.Intn(2) == 0 {
+			if repalette != nil && rng.Intn(2) == 0 {
+				clr = pick(s)
+			} else {
+				s.Mutate(rng)
+			}
+		}
+		if repalette == nil {
+			clr = pick(s)
+		}
+		score(s)
+		return member{s, clr, old, neu}
+	}
+
+	limit := iterLimit
+	if j.iters > 0 {
+		limit = j.iters
+	}
+	if lineScheduled() && start > 0 {
+		// As it was when the checkpoint was saved.
+		lineLen = lengthAt(start-1, limit)
+	}
+	// With -plateau, the RMS error as of each check over the last
+	// -plateau-window iterations, from the oldest, in a ring from next.
+	var trail []float64
+	next := 0
+	if plateau > 0 {
+		trail = make([]float64, 0, plateauWindow/50+1)
+	}
+	granted, stepping := 0, false // of j.steps
+	rateFrom, rateStart := start, time.Now()
+	// With -anneal, a worse candidate is accepted with odds falling off
+	// exponentially with how much worse it makes the pixels it covers,
+	// relative to the temperature, which starts at -anneal-temp and cools
+	// by -anneal-cool each iteration.
+	temp := annealTemp * math.Pow(annealCool, float64(start))
+	for i := start; i < limit || limit < 0; i++ {
+		if j.steps != nil && granted == 0 {
+			if stepping {
+				j.stepped <- canvas
+			}
+			if granted, stepping = <-j.steps; !stepping {
+				break
+			}
+		}
+		granted--
+		stati++
+		if residualEvery > 0 && (i-start)%residualEvery == 0 {
+			refreshResidual()
+		}
+		shape := propose()
+		if populationSize > 0 {
+			pop = append(pop[:0], member{shape, clr, old, neu})
+			for len(pop) < populationSize {
+				s := propose()
+				pop = append(pop, member{s, clr, old, neu})
+			}
+			best := evolve(rng, pop, generations, breed)
+			shape, clr, old, neu = best.shape, best.clr, best.old, best.neu
+		}
+		// With -candidates, the best of that many is tried.
+		for k := 1; k < numCandidates; k++ {
+			bestClr, bestOld, bestNeu := clr, old, neu
+			if t := propose(); neu-old < bestNeu-bestOld {
+				shape = t
+			} else {
+				clr, old, neu = bestClr, bestOld, bestNeu
+			}
+		}
+		better := neu < old
+		if anneal {
+			if !better && old > 0 {
+				better = rng.Float64() < math.Exp((old-neu)/(temp*old))
+			}
+			temp *= annealCool
+		}
+
+		if better {
+			// converges
+			if blended {
+				cover(shape, paintCover)
+			} else {
+				clrs = colorSamples(clr)
+				shape.Rasterize(paint)
+			}
+			if gpu != nil {
+				if err := gpu.update(shape.(*Line), errs); err != nil {
+					log.Fatalln(err)
+				}
+			}
+			statc++
+			totalc++
+			if svgFile != "" || strokeLog != nil {
+				strokes = append(strokes, stroke{shape, clr, i, strokeAlpha})
+			}
+			if strokeLimit > 0 && totalc >= strokeLimit {
+				logger.Info("stroke limit reached", "iters", i+1)
+				break
+			}
+			if targetErr > 0 && rmsError(errs.sum, w*h) < targetErr {
+				logger.Info("reached target error", "iters", i+1, "converged", totalc)
+				break
+			}
+		}
+		if iterRate > 0 {
+			// Sleep off any lead on -rate.
+			if ahead := time.Duration(float64(i-rateFrom)/iterRate*float64(time.Second)) - time.Since(rateStart); ahead > 0 {
+				time.Sleep(ahead)
+			}
+		}
+		if i%50 == 0 { // don't smash that time.Now()
+			if lineScheduled() {
+				lineLen = lengthAt(i, limit)
+			}
+			if liveView != nil {
+				liveView.offer(canvas)
+			}
+			if ndiView != nil {
+				ndiView.offer(canvas)
+			}
+			if rtmpView != nil {
+				rtmpView.offer(canvas)
+			}
+			if control != nil {
+				if p, ok := control.take(); ok {
+					if p.Colors != numColors && repalette != nil {
+						numColors = p.Colors
+						repalette()
+					}
+					if p.Rate != iterRate {
+						rateFrom, rateStart = i, time.Now()
+					}
+					lineLen, saveInterval, strokeAlpha, iterLimit, iterRate = p.LineLen, p.SaveInterval, p.Alpha, p.IterLimit, p.Rate
+					if j.iters == 0 {
+						limit = iterLimit
+					}
+					lapseInterval = lapseEvery()
+					blended = covered || strokeAlpha < 255
+					opacity = float64(strokeAlpha) / 255
+					logger.Info("parameters changed", "l", lineLen, "save", saveInterval, "alpha", strokeAlpha, "iter", iterLimit, "colors", numColors, "rate", iterRate)
+				}
+			}
+			if paused.Load() {
+				// Time paused isn't counted. A save asked for while
+				// paused is made, then the loop pauses again.
+				t := time.Now()
+				for paused.Load() && !interrupted.Load() && !saveWanted.Load() {
+					time.Sleep(50 * time.Millisecond)
+				}
+				d := time.Since(t)
+				startTime, lastStatTime, rateStart = startTime.Add(d), lastStatTime.Add(d), rateStart.Add(d)
+			}
+			if interrupted.Load() {
+				logger.Info("interrupted", "iters", i, "converged", totalc, "elapsed", time.Since(startTime).Round(time.Millisecond))
+				if checkpointFile != "" {
+					saveCheckpoint(i)
+				}
+				break
+			}
+			now := time.Now()
+			if duration > 0 && now.Sub(startTime) >= duration {
+				logger.Info("time limit reached", "iters", i, "converged", totalc)
+				break
+			}
+			if trail != nil {
+				rms := rmsError(errs.sum, w*h)
+				if len(trail) < cap(trail) {
+					trail = append(trail, rms)
+				} else {
+					if trail[next]-rms < plateau*trail[next] {
+						logger.Info("error plateaued", "iters", i, "converged", totalc)
+						break
+					}
+					trail[next] = rms
+					next = (next + 1) % len(trail)
+				}
+			}
+			dur := now.Sub(lastSaveTime)
+			if saveWanted.CompareAndSwap(true, false) || saveInterval > 0 && dur >= time.Duration(saveInterval)*time.Second {
+				n := incrSaves.Add(1)
+				save(canvas, fmt.Sprintf(incrPattern, n))
+				if compareOutput {
+					save(sideBySide(img, canvas, errs.heatmap()), fmt.Sprintf(comparePattern, n))
+				}
+				report()
+				lastSaveTime = now
+			}
+			if timelapse != nil && now.Sub(lastLapseTime) >= lapseInterval {
+				timelapse.add(canvas)
+				lastLapseTime = now
+			}
+			if errmapOutput && now.Sub(lastErrmapTime) >= lapseInterval {
+				save(errs.heatmap(), fmt.Sprintf(errmapPattern, errmapSaves.Add(1)))
+				lastErrmapTime = now
+			}
+			if checkpointFile != "" && now.Sub(lastCheckpointTime) >= checkpointInterval {
+				saveCheckpoint(i)
+				lastCheckpointTime = now
+			}
+			dur = now.Sub(lastStatTime)
+			if dur >= time.Duration(statInterval)*time.Second {
+				ips := float64(stati) / dur.Seconds()
+				cps := float64(statc) / dur.Seconds()
+				r := statReport{Frame: j.n, Iter: i, IterRate: ips, Accepted: totalc, AcceptRate: cps, RMSError: rmsError(errs.sum, w*h), Elapsed: now.Sub(startTime).Seconds()}
+				if statsJSON != nil {
+					if err := statsJSON.write(r); err != nil {
+						log.Fatalln(err)
+					}
+				} else if !quiet {
+					logger.Info("progress", "iters", i, "iter/s", math.Round(ips), "converg/s", math.Round(cps), "c/i%", math.Round(1e4*cps/ips)/100)
+				}
+				if statsCSV != nil {
+					if err := statsCSV.write(r); err != nil {
+						log.Fatalln(err)
+					}
+				}
+				if j.progress != nil {
+					j.progress(r, canvas)
+				}
+				if liveView != nil {
+					liveView.report(r)
+				}
+				if termView != nil {
+					termView.show(canvas)
+				}
+				stati = 0
+				statc = 0
+				lastStatTime = now
+			}
+		}
+	}
+
+	if timelapse != nil {
+		timelapse.add(canvas)
+	}
+	report()
+	j.rms = rmsError(errs.sum, w*h)
+	return canvas, strokes
+}
+
+// lapseEvery returns how often -timelapse and -errmap take a frame: every
+// -save interval, or every second.
+func lapseEvery() time.Duration {
+	if saveInterval > 0 {
+		return time.Duration(saveInterval) * time.Second
+	}
+	return time.Second
+}
+
+// blankCanvas returns a canvas of colour bg, with the size of r, and with any
+// -init image drawn over it.
+func blankCanvas(r image.Rectangle, bg color.RGBA) *image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{bg}, image.ZP, draw.Src)
+	if initImage != nil {
+		ir := initImage.Bounds()
+		if ir.Size() == canvas.Rect.Size() {
+			draw.Draw(canvas, canvas.Bounds(), initImage, ir.Min, draw.Over)
+		} else {
+			xdraw.CatmullRom.Scale(canvas, canvas.Bounds(), initImage, ir, draw.Over, nil)
+		}
+	}
+	return canvas
+}
+
+// sideBySide returns imgs next to each other, from left to right.
+func sideBySide(imgs ...image.Image) *image.RGBA {
+	var w, h int
+	for _, img := range imgs {
+		w += img.Bounds().Dx()
+		h = imax(h, img.Bounds().Dy())
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	x := 0
+	for _, img := range imgs {
+		r := img.Bounds()
+		draw.Draw(out, image.Rect(x, 0, x+r.Dx(), r.Dy()), img, r.Min, draw.Src)
+		x += r.Dx()
+	}
+	return out
+}
+
+// frameBackground returns the background colour for sketching src.
+func frameBackground(src image.Image) color.RGBA {
+	if bgAverage {
+		return averageColor(src)
+	}
+	return background
+}
+
+// parseBackground parses the -bg flag, reporting whether it is "avg".
+// Hex colours are not premultiplied, as in CSS.
+func parseBackground(s string) (color.RGBA, bool, error) {
+	switch s {
+	case "black":
+		return color.RGBA{0, 0, 0, 255}, false, nil
+	case "white":
+		return color.RGBA{255, 255, 255, 255}, false, nil
+	case "transparent":
+		return color.RGBA{}, false, nil
+	case "avg":
+		return color.RGBA{}, true, nil
+	}
+	if len(s) == 7 || len(s) == 9 {
+		c := color.NRGBA{A: 255}
+		if n, _ := fmt.Sscanf(s, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A); n == len(s)/2 {
+			return color.RGBAModel.Convert(c).(color.RGBA), false, nil
+		}
+	}
+	return color.RGBA{}, false, fmt.Errorf("invalid background %q", s)
+}
+
+// validateFlags checks the sketching flags are within bounds, and go
+// together.
+func validateFlags() error {
+	if useGPU && gpuBatchSize < 1 {
+		return fmt.Errorf("bad GPU batch size %d", gpuBatchSize)
+	}
+	if edgeBias < 0 || edgeBias > 1 {
+		return fmt.Errorf("bad edge bias %g", edgeBias)
+	}
+	if focusBias < 0 || focusBias > 1 {
+		return fmt.Errorf("bad focus bias %g", focusBias)
+	}
+	if residualEvery < 0 {
+		return fmt.Errorf("bad residual interval %d", residualEvery)
+	}
+	if residualEvery > 0 && focusBias > 0 {
+		return errors.New("-focus and -residual both place strokes by the error left, use one")
+	}
+	if flowStrength < 0 || flowStrength > 1 {
+		return fmt.Errorf("bad flow strength %g", flowStrength)
+	}
+	if hatchPasses < 0 || hatchPasses > len(hatchAngles) {
+		return fmt.Errorf("bad number of hatching passes %d, the most is %d", hatchPasses, len(hatchAngles))
+	}
+	if hatchSpacing < 2 {
+		return fmt.Errorf("bad hatch spacing %d", hatchSpacing)
+	}
+	if numColors < 0 {
+		return fmt.Errorf("bad number of colours %d", numColors)
+	}
+	if iterRate < 0 {
+		return fmt.Errorf("bad iteration rate %g", iterRate)
+	}
+	if numCandidates < 1 {
+		return fmt.Errorf("bad number of candidates %d", numCandidates)
+	}
+	if plateau < 0 || plateau >= 1 {
+		return fmt.Errorf("bad plateau %g", plateau)
+	}
+	if plateauWindow < 50 {
+		return fmt.Errorf("bad plateau window %d, the least is 50", plateauWindow)
+	}
+	if tileSize < 0 || tileSize > 0 && (tileOverlap < 0 || 2*tileOverlap >= tileSize) {
+		return fmt.Errorf("bad tiles of %d pixels overlapping by %d", tileSize, tileOverlap)
+	}
+	if tileJobs < 1 {
+		return fmt.Errorf("bad number of tile jobs %d", tileJobs)
+	}
+	if maxDim < 0 {
+		return fmt.Errorf("bad -max-dim %d", maxDim)
+	}
+	if numRestarts < 1 {
+		return fmt.Errorf("bad number of restarts %d", numRestarts)
+	}
+	if restartJobs < 1 {
+		return fmt.Errorf("bad number of restart jobs %d", restartJobs)
+	}
+	if pyramidLevels < 1 || pyramidLevels > 16 {
+		return fmt.Errorf("bad number of pyramid levels %d", pyramidLevels)
+	}
+	if populationSize < 0 || populationSize == 1 {
+		return fmt.Errorf("bad population size %d", populationSize)
+	}
+	if generations < 0 {
+		return fmt.Errorf("bad number of generations %d", generations)
+	}
+	if populationSize > 0 && numCandidates > 1 {
+		return errors.New("-genetic tries the best of its population, in place of -candidates")
+	}
+	if climbSteps < 0 {
+		return fmt.Errorf("bad number of mutations %d", climbSteps)
+	}
+	if anneal && (annealTemp <= 0 || annealCool <= 0 || annealCool > 1) {
+		return fmt.Errorf("bad annealing schedule: temperature %g, cooling by %g", annealTemp, annealCool)
+	}
+	if paletteSize < 1 {
+		return fmt.Errorf("bad palette size %d", paletteSize)
+	}
+	if strokeAlpha < 1 || strokeAlpha > 255 {
+		return fmt.Errorf("bad stroke alpha %d", strokeAlpha)
+	}
+	if numJobs < 1 {
+		return fmt.Errorf("bad number of jobs %d", numJobs)
+	}
+	return nil
+}
+
+// setupSketch checks and loads what the sketching flags refer to. A worker
+// calls it again once it has the coordinator's flags.
+func setupSketch() error {
+	if err := validateFlags(); err != nil {
+		return err
+	}
+	if _, ok := shapes[shapeKind]; !ok {
+		return fmt.Errorf("unknown shape %q", shapeKind)
+	}
+	if !colorModes[colorMode] {
+		return fmt.Errorf("unknown colour mode %q", colorMode)
+	}
+	var err error
+	if background, bgAverage, err = parseBackground(bgFlag); err != nil {
+		return err
+	}
+	if lineAngles, err = parseAngles(anglesFlag); err != nil {
+		return err
+	}
+	if minWidth, maxWidth, err = parseWidth(widthFlag); err != nil {
+		return err
+	}
+	if lineLenFrom, lineLenTo, err = parseLength(lineFlag); err != nil {
+		return err
+	}
+	lineLen = lineLenFrom
+	if lineDecay != "linear" && lineDecay != "exp" {
+		return fmt.Errorf("unknown -l decay %q", lineDecay)
+	}
+	if cropArea, err = parseCrop(cropFlag); err != nil {
+		return err
+	}
+	if memoryBudget, err = parseBytes(memoryFlag); err != nil {
+		return err
+	}
+	if memoryBudget > 0 {
+		debug.SetMemoryLimit(memoryBudget)
+	} else {
+		debug.SetMemoryLimit(gcLimit)
+	}
+	if lineScheduled() && (numJobs > 1 || numRestarts > 1 && restartJobs > 1 || (tileSize > 0 || memoryBudget > 0) && tileJobs > 1) {
+		return errors.New("an -l schedule can only be used with a single job")
+	}
+	switch metricName {
+	case "rgb", "linear", "lab", "ssim":
+		labMetric, linearMetric = metricName == "lab", metricName == "linear"
+	default:
+		return fmt.Errorf("unknown metric %q", metricName)
+	}
+	if channelScale, err = parseWeights(weightsFlag); err != nil {
+		return err
+	}
+	if noAlpha {
+		channelScale[3] = 0
+		if channelScale == [4]float64{} {
+			return errors.New("-no-alpha leaves no channels to compare")
+		}
+	}
+	weighted = channelScale != [4]float64{1, 1, 1, 1}
+	ink = color.RGBA{0, 0, 0, 255}
+	if inkFlag != "" {
+		if ink, err = parseInk(inkFlag); err != nil {
+			return err
+		}
+		if colorMode != "palette" {
+			return errors.New("-ink can't be used with -color")
+		}
+	}
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if (hatchPasses > 0 || inkFlag != "") && !set["bg"] {
+		// Dark ink on white, or light ink on black.
+		background = color.RGBA{255, 255, 255, 255}
+		if luma(ink) >= 0x80 {
+			background = color.RGBA{0, 0, 0, 255}
+		}
+	}
+	if duotoneFlag != "" {
+		if duotone, err = parseDuotone(duotoneFlag); err != nil {
+			return err
+		}
+		if inkFlag != "" || hatchPasses > 0 {
+			return errors.New("-duotone can't be used with -ink or -hatch")
+		}
+		if !set["bg"] {
+			background = duotone[1]
+		}
+	}
+	if hatchPasses > 0 {
+		if !set["angles"] {
+			lineAngles = nil
+			for _, a := range hatchAngles[:hatchPasses] {
+				lineAngles = append(lineAngles, a*math.Pi/180)
+			}
+		}
+	}
+	initImage, maskImage, weightImage = nil, nil, nil
+	if initFile != "" {
+		if initImage, err = readImage(initFile); err != nil {
+			return err
+		}
+	}
+	if maskFile != "" {
+		if maskImage, err = readImage(maskFile); err != nil {
+			return err
+		}
+	}
+	if weightFile != "" {
+		if weightImage, err = readImage(weightFile); err != nil {
+			return err
+		}
+	}
+	paletteImage = nil
+	if paletteFile != "" {
+		img, err := readImage(paletteFile)
+		if err != nil {
+			return err
+		}
+		r := img.Bounds()
+		paletteImage = image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+		draw.Draw(paletteImage, paletteImage.Rect, img, r.Min, draw.Src)
+	}
+	brushTip = nil
+	if brushFile != "" {
+		if brushTip, err = loadBrush(brushFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLength parses the -l flag, a length or a schedule of them.
+func parseLength(s string) (int, int, error) {
+	from, to, ok := strings.Cut(s, ":")
+	if !ok {
+		to = from
+	}
+	a, err := strconv.Atoi(from)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid line length %q", s)
+	}
+	b, err := strconv.Atoi(to)
+	if err != nil || a < 1 || b < 1 {
+		return 0, 0, fmt.Errorf("invalid line length %q", s)
+	}
+	return a, b, nil
+}
+
+// lineLenFrom and lineLenTo are the lengths an -l schedule goes between,
+// which are the same for a single length.
+var lineLenFrom, lineLenTo int
+
+func lineScheduled() bool {
+	return lineLenFrom != lineLenTo
+}
+
+// lengthAt returns the length on the -l schedule at iteration i of limit.
+func lengthAt(i, limit int) int {
+	t := min(float64(i)/float64(limit), 1)
+	a, b := float64(lineLenFrom), float64(lineLenTo)
+	if lineDecay == "exp" {
+		return int(math.Round(a * math.Pow(b/a, t)))
+	}
+	return int(math.Round(a + (b-a)*t))
+}
+
+// parseWidth parses the -width flag, a width or a range of them.
+func parseWidth(s string) (int, int, error) {
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		hi = lo
+	}
+	a, err := strconv.Atoi(lo)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid width %q", s)
+	}
+	b, err := strconv.Atoi(hi)
+	if err != nil || a < 1 || b < a {
+		return 0, 0, fmt.Errorf("invalid width %q", s)
+	}
+	return a, b, nil
+}
+
+// parseAngles parses the -angles flag.
+func parseAngles(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var angles []float64
+	for _, f := range strings.Split(s, ",") {
+		deg, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid angle %q", f)
+		}
+		angles = append(angles, deg*math.Pi/180)
+	}
+	return angles, nil
+}
+
+// parseWeights parses the -weights flag, returning the square roots of the
+// weights, which scale the channels' samples.
+func parseWeights(s string) ([4]float64, error) {
+	var scale [4]float64
+	f := strings.Split(s, ",")
+	if len(f) != len(scale) {
+		return scale, fmt.Errorf("invalid weights %q", s)
+	}
+	for i := range scale {
+		w, err := strconv.ParseFloat(strings.TrimSpace(f[i]), 64)
+		if err != nil || w < 0 {
+			return scale, fmt.Errorf("invalid weight %q", f[i])
+		}
+		scale[i] = math.Sqrt(w)
+	}
+	if scale == [4]float64{} {
+		return scale, fmt.Errorf("invalid weights %q", s)
+	}
+	return scale, nil
+}
+
+// stdinArg reports whether - appears among the file arguments.
+func stdinArg(args []string) bool {
+	for _, arg := range args {
+		if arg == "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSeed parses the -seed flag, drawing a seed from the operating system's
+// entropy source for "random".
+func parseSeed(s string) (int64, error) {
+	if s != "random" {
+		seed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid seed %q", s)
+		}
+		return seed, nil
+	}
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]) >> 1), nil
+}
+
+// Main runs the sketch command.
+func Main() {
+	log.SetFlags(0)
+	if wasm {
+		runJS()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		replay(os.Args[2:])
+		return
+	}
+	serving := len(os.Args) > 1 && os.Args[1] == "serve"
+	if serving {
+		flag.StringVar(&listenAddr, "listen", ":8080", "with serve, `address` to listen on")
+		flag.StringVar(&grpcAddr, "grpc", "", "with serve, also serve gRPC on `address` (requires -tags grpc)")
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
+	if !showWindow {
+		run(serving)
+		return
+	}
+
+	// The window has to have the main thread, so the run goes on alongside
+	// it, and closes it once done. Closing the window interrupts the run.
+	if !haveWindow {
+		log.Fatalln("built without -window, rebuild with -tags window")
+	}
+	liveView = new(snapshot)
+	done := make(chan struct{})
+	go func() {
+		run(serving)
+		close(done)
+	}()
+	err := runWindow(done)
+	interrupted.Store(true)
+	<-done
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// run carries out a run of sketch, or with serving, the serve subcommand,
+// with the flags parsed.
+func run(serving bool) {
+	var resume *checkpoint
+	args := flag.Args()
+	if resumeFile != "" {
+		var err error
+		if resume, err = loadCheckpoint(resumeFile); err != nil {
+			log.Fatalln(err)
+		}
+		configure(resume.Flags)
+		seedFlag = strconv.FormatInt(resume.Seed, 10)
+		if len(args) == 0 {
+			args = resume.Args
+		}
+	}
+	if logFormat != "text" && logFormat != "json" {
+		log.Fatalf("unknown log format %q\n", logFormat)
+	}
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		logOutput = f
+	}
+	setupLogging()
+
+	seed, err := parseSeed(seedFlag)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if inPattern, err = framePattern(inPattern); err != nil {
+		log.Fatalln(err)
+	}
+	if outPattern, err = framePattern(outPattern); err != nil {
+		log.Fatalln(err)
+	}
+	if _, ok := formatExt[format]; !ok {
+		log.Fatalf("unknown format %q\n", format)
+	}
+	if outDir != "" && !isObject(outDir) {
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if err := setupSketch(); err != nil {
+		log.Fatalln(err)
+	}
+	if useGPU && (shapeKind != "line" || maxWidth > 1 || antialias || strokeAlpha < 255 || brushTip != nil || metricName != "rgb" || weighted) {
+		slog.Warn("only plain one pixel wide lines are scored on the GPU, in unweighted RGB, using the CPU")
+		useGPU = false
+	}
+	if termPreview != "" && termPreview != "auto" && !termProtocols[termPreview] {
+		log.Fatalf("unknown terminal graphics protocol %q\n", termPreview)
+	}
+	if statsFormat != "text" && statsFormat != "json" {
+		log.Fatalf("unknown statistics format %q\n", statsFormat)
+	}
+	if statsFormat == "json" && statsOutFile == "" && stdinArg(args) && encodeFile == "" && gifFile == "" {
+		log.Fatalln("-stats-format json needs -stats-out when frames are written to standard output")
+	}
+	if compareOutput && saveInterval <= 0 {
+		log.Fatalln("-compare needs -save")
+	}
+	if serving && (len(args) > 0 || videoFile != "" || cameraDevice != "" || screenRegion != "" || encodeFile != "" || gifFile != "" || timelapseFile != "" || warmStart || adaptive || checkpointFile != "" || resumeFile != "" || coordinatorAddr != "" || workerURL != "") {
+		log.Fatalln("serve sketches each image it is sent on its own, and takes no files and no flags for a run of frames")
+	}
+	if watchDir != "" && (serving || len(args) > 0 || videoFile != "" || cameraDevice != "" || screenRegion != "" || encodeFile != "" || gifFile != "" || timelapseFile != "" || warmStart || adaptive || checkpointFile != "" || resumeFile != "" || coordinatorAddr != "" || workerURL != "") {
+		log.Fatalln("-watch sketches each image on its own, and takes no files and no flags for a run of frames")
+	}
+	if format == "webp" && isObject(outDir) {
+		log.Fatalln("WebP is written by ffmpeg, which can't write to object storage")
+	}
+	if watchDir != "" && sameDir(watchDir, outDir) {
+		log.Fatalln("-watch needs an -outdir other than the directory it watches")
+	}
+	if _, ok := serveTypes[format]; serving && !ok {
+		log.Fatalf("serve can't send %s images\n", format)
+	}
+	if checkpointFile != "" && (numJobs > 1 || coordinatorAddr != "" || workerURL != "") {
+		log.Fatalln("-checkpoint can only be used with a single job")
+	}
+	if (controlAddr != "" || oscAddr != "" || midiDevice != "") && (serving || watchDir != "" || numJobs > 1 || numRestarts > 1 && restartJobs > 1 || (tileSize > 0 || memoryBudget > 0) && tileJobs > 1 || coordinatorAddr != "" || workerURL != "") {
+		log.Fatalln("-control, -osc and -midi can only be used with a single job")
+	}
+	if resume != nil && (encodeFile != "" || gifFile != "" || stdinArg(args)) {
+		log.Fatalln("-resume can't carry on with -encode, -gif or standard input")
+	}
+	if screenRegion != "" && !validScreenRegion(screenRegion) {
+		log.Fatalf("bad screen region %q, want all or WxH+X+Y\n", screenRegion)
+	}
+	if screenRegion != "" && screenRate <= 0 {
+		log.Fatalf("bad screen frame rate %g\n", screenRate)
+	}
+	if cameraDevice != "" && screenRegion != "" {
+		log.Fatalln("-camera and -screen can't be used together")
+	}
+	if (cameraDevice != "" || screenRegion != "") && (len(args) > 0 || videoFile != "" || checkpointFile != "" || resumeFile != "" || adaptive) {
+		log.Fatalln("-camera and -screen sketch frames as they come, and can't be used with other input, -checkpoint, -resume or -adaptive")
+	}
+	if cameraDevice != "" || screenRegion != "" {
+		warmStart = true
+	}
+	if adaptive && iterLimit < 0 {
+		log.Fatalln("-adaptive needs an -iter limit to share out")
+	}
+	if lineScheduled() && (iterLimit < 0 || controlAddr != "" || oscAddr != "" || midiDevice != "") {
+		log.Fatalln("an -l schedule needs an -iter limit, and can't be changed with -control, -osc or -midi")
+	}
+	if numRestarts > 1 && (checkpointFile != "" || resumeFile != "" || timelapseFile != "") {
+		log.Fatalln("-restarts can't be used with -checkpoint, -resume or -timelapse")
+	}
+	if tileSize > 0 && (checkpointFile != "" || resumeFile != "" || timelapseFile != "") {
+		log.Fatalln("-tiles can't be used with -checkpoint, -resume or -timelapse")
+	}
+	if cropComposite && cropFlag == "" {
+		log.Fatalln("-crop-composite needs a -crop rectangle")
+	}
+	if cropComposite && (serving || watchDir != "") {
+		log.Fatalln("-crop-composite writes the frames of a run, and can't be used with serve or -watch")
+	}
+	if restartsOut && (serving || watchDir != "" || coordinatorAddr != "") {
+		log.Fatalln("-restarts-out writes restarts alongside the frames of a run, and can't be used with serve, -watch or -coordinator")
+	}
+	if pyramidLevels > 1 && (iterLimit < 0 || checkpointFile != "" || resumeFile != "" || timelapseFile != "") {
+		log.Fatalln("-pyramid needs an -iter limit to share out between its levels, and can't be used with -checkpoint, -resume or -timelapse")
+	}
+	if warmStart && coordinatorAddr != "" {
+		log.Fatalln("-warm frames depend on the one before, and can't be handed out with -coordinator")
+	}
+	if (numJobs > 1 || coordinatorAddr != "") && timelapseFile != "" {
+		log.Fatalln("-timelapse records a single canvas, and can't be used with -jobs or -coordinator")
+	}
+
+	slog.Info("seed", "seed", seed)
+	catchInterrupt()
+	catchPause()
+	catchSave()
+	defer startProfiling()()
+	runState = checkpoint{Seed: seed, Flags: setFlags(map[string]bool{"resume": true}), Args: args}
+
+	if termPreview != "" {
+		termView = newTermPreviewer(termPreview)
+	}
+	if rtmpURL != "" {
+		rtmpView = new(snapshot)
+		rtmp = streamRTMP(rtmpURL, rtmpView)
+	}
+	if ndiName != "" {
+		ndiView = new(snapshot)
+		if err := runNDI(ndiName, ndiView); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if previewAddr != "" {
+		if preview, err = listenPreview(previewAddr); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if controlAddr != "" || oscAddr != "" || midiDevice != "" {
+		control = newController()
+	}
+	if controlAddr != "" {
+		if err := control.listen(controlAddr); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if oscAddr != "" {
+		if err := control.listenOSC(oscAddr); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if midiDevice != "" {
+		if err := control.readMIDI(midiDevice); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if serving {
+		serve(listenAddr, grpcAddr, seed)
+		return
+	}
+	if workerURL != "" {
+		work(workerURL)
+		return
+	}
+	if watchDir != "" {
+		watch(watchDir, seed)
+		return
+	}
+	var coord *coordinator
+	if coordinatorAddr != "" {
+		if coord, err = listenCoordinator(coordinatorAddr, seed); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if statsFormat == "json" {
+		if statsJSON, err = openStats(statsOutFile); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if statsCSVFile != "" {
+		if statsCSV, err = openStatsCSV(statsCSVFile); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if strokeLogFile != "" {
+		strokeLog, err = openStrokeLog(strokeLogFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	var in source
+	switch {
+	case videoFile != "":
+		v, err := openVideo(videoFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		in = v
+	case cameraDevice != "":
+		c, err := openCamera(cameraDevice)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		in = c
+	case screenRegion != "":
+		s, err := openScreen(screenRegion, screenRate)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		in = s
+	case len(args) > 0:
+		names, err := expandArgs(args)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		in = &fileSource{names: names}
+	default:
+		in = &seqSource{n: frameStart}
+	}
+
+	if timelapseFile != "" {
+		timelapse = &gifSink{name: timelapseFile}
+	}
+
+	var delay int // of the frame being written
+	var out sink = fileSink{}
+	switch {
+	case encodeFile != "":
+		out = &encodeSink{name: encodeFile}
+	case gifFile != "":
+		out = &gifSink{name: gifFile, delay: func() int { return delay }}
+	case stdinArg(args):
+		out = stdoutSink{}
+	}
+
+	// Numbering carries on after any earlier output, unless resuming, where
+	// the checkpoint has it.
+	if resume == nil && !overwrite {
+		n, err := lastSaved(incrPattern)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		incrSaves.Store(int32(n))
+		if n, err = lastSaved(errmapPattern); err != nil {
+			log.Fatalln(err)
+		}
+		errmapSaves.Store(int32(n))
+		if _, ok := out.(fileSink); ok {
+			if n, err = lastSaved(outPattern); err != nil {
+				log.Fatalln(err)
+			}
+			if n > 0 {
+				slog.Info("numbering frames after earlier output", "last", fmt.Sprintf(outPattern, n))
+			}
+			saveNum = n + 1
+		}
+	}
+	runState.FirstSave = saveNum
+
+	first := 0
+	if resume != nil {
+		first = resume.Frame
+		slog.Info("resuming", "frame", first)
+		for n := 0; n < first; n++ {
+			if _, err := in.next(); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		saveNum = resume.FirstSave + first
+		incrSaves.Store(resume.IncrSaves)
+	}
+
+	// Frames are read and sketched in the background, or handed out to
+	// workers, up to -jobs at a time, and written here in order.
+	pending := make(chan *job, numJobs)
+	go func() {
+		running := make(chan struct{}, numJobs)
+		var prev *job
+		var prevSrc image.Image
+		var bud budget
+		if resume != nil {
+			bud = resume.Budget
+		}
+		for n := first; ; n++ {
+			if frameLimit > 1 && n > frameLimit {
+				break
+			}
+			running <- struct{}{}
+			if interrupted.Load() {
+				break
+			}
+			src, err := in.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Fatalln(err)
+			}
+			full := src
+			src, crop, err := cropSource(src)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			var scale float64
+			src, scale = fitMaxDim(src)
+			j := newJob(n, src, frameDelay(in), seed, numJobs > 1 || coord != nil)
+			j.scale = scale
+			if cropComposite {
+				j.full, j.crop = full, crop
+			}
+			switch {
+			case warmStart && prev != nil && sceneCut > 0 && frameDiff(prevSrc, src) > sceneCut:
+				j.logger.Info("scene cut, starting from a blank canvas")
+			case warmStart && prev != nil:
+				<-prev.done
+				j.warm, j.warmStrokes = prev.warmState()
+				j.bg = prev.bg
+			case warmStart && resume != nil && resume.Warm != nil:
+				if j.warm, j.warmStrokes, j.bg, err = resume.warmState(); err != nil {
+					log.Fatalln(err)
+				}
+			}
+			if resume != nil && n == first && resume.Canvas != nil {
+				j.resume = resume
+				j.draws.skip(resume.Draws)
+				j.iters, j.budget = resume.Iters, bud
+			} else if adaptive {
+				start := j.warm
+				if start == nil {
+					start = blankCanvas(src.Bounds(), j.bg)
+				}
+				j.iters, bud = bud.allocate(frameDiff(src, start))
+				j.budget = bud
+				j.logger.Debug("adaptive budget", "iters", j.iters)
+			}
+			prev, prevSrc = j, src
+			if coord != nil {
+				coord.add(n, j, func() { <-running })
+			} else {
+				go func() {
+					j.run()
+					<-running
+				}()
+			}
+			pending <- j
+		}
+		if coord != nil {
+			coord.close()
+		}
+		close(pending)
+	}()
+
+	for j := range pending {
+		j.wait()
+		w, h := j.img.Bounds().Dx(), j.img.Bounds().Dy()
+		if strokeLog != nil {
+			strokeLog.frame(saveNum, w, h, j.scale, j.bg, j.warm != nil)
+			for _, s := range j.strokes {
+				strokeLog.stroke(saveNum, s)
+			}
+		}
+		if svgFile != "" {
+			name := svgName(svgFile, saveNum)
+			if err := writeSVG(name, w, h, j.scale, j.bg, j.allStrokes()); err != nil {
+				log.Fatalln(err)
+			}
+			slog.Info("wrote", "file", name)
+		}
+		// framed returns img as it is written, over the whole source with
+		// -crop-composite.
+		framed := func(img *image.RGBA) *image.RGBA {
+			if j.full == nil {
+				return img
+			}
+			return composite(j.full, j.crop, img)
+		}
+		for r, img := range j.others {
+			if img != nil {
+				save(framed(img), fmt.Sprintf(restartPattern, saveNum, r))
+			}
+		}
+		delay = j.delay
+		if err := out.write(framed(j.img)); err != nil {
+			log.Fatalln(err)
+		}
+		if checkpointFile != "" && !interrupted.Load() {
+			warm, warmStrokes := j.warmState()
+			if err := writeCheckpoint(frameCheckpoint(j.n+1, warm, warmStrokes, j.bg, j.budget)); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	}
+	in.close()
+	if err := out.close(); err != nil {
+		log.Fatalln(err)
+	}
+	if strokeLog != nil {
+		if err := strokeLog.close(); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if statsJSON != nil {
+		if err := statsJSON.close(); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if statsCSV != nil {
+		if err := statsCSV.close(); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if timelapse != nil {
+		if err := timelapse.close(); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if rtmp != nil {
+		rtmp.close()
+	}
+	slog.Info("end of frames")
+}
\ No newline at end of file
@@ -0,0 +1,89 @@
+package sketch
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// The diff and copy paths index the Pix of planes and image.RGBAs, where
+// they once went through image.Image's At and Set. The At benchmarks are
+// the old way, for comparison.
+
+// benchLines returns random lines across a w by h image.
+func benchLines(rng *rand.Rand, w, h int) [][4]int {
+	lines := make([][4]int, 1000)
+	for i := range lines {
+		x, y := rng.Intn(w), rng.Intn(h)
+		lines[i] = [4]int{x, y, x + rng.Intn(81) - 40, y + rng.Intn(81) - 40}
+	}
+	return lines
+}
+
+func BenchmarkBdiff(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	src := newPlane(randomRGBA(rng, 512, 512))
+	lines := benchLines(rng, 512, 512)
+	c := color.RGBA{0x40, 0x80, 0xc0, 0xff}
+	for b.Loop() {
+		for _, l := range lines {
+			bdiff(src, c, l[0], l[1], l[2], l[3])
+		}
+	}
+}
+
+func BenchmarkBdiffAt(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	var src image.Image = randomRGBA(rng, 512, 512)
+	lines := benchLines(rng, 512, 512)
+	var c color.Color = color.RGBA{0x40, 0x80, 0xc0, 0xff}
+	for b.Loop() {
+		for _, l := range lines {
+			var dif float64
+			bline(l[0], l[1], l[2], l[3], func(x, y int) {
+				if !(image.Point{x, y}.In(src.Bounds())) {
+					return
+				}
+				sR, sG, sB, sA := src.At(x, y).RGBA()
+				cR, cG, cB, cA := c.RGBA()
+				R, G, B, A := float64(sR)-float64(cR), float64(sG)-float64(cG), float64(sB)-float64(cB), float64(sA)-float64(cA)
+				dif += math.Sqrt(R*R + G*G + B*B + A*A)
+			})
+		}
+	}
+}
+
+func BenchmarkCopy(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	dst, src := randomRGBA(rng, 512, 512), randomRGBA(rng, 512, 512)
+	lines := benchLines(rng, 512, 512)
+	copyPix := func(x, y int) {
+		if (image.Point{x, y}.In(dst.Rect)) {
+			i := dst.PixOffset(x, y)
+			copy(dst.Pix[i:i+4:i+4], src.Pix[i:i+4:i+4])
+		}
+	}
+	for b.Loop() {
+		for _, l := range lines {
+			bline(l[0], l[1], l[2], l[3], copyPix)
+		}
+	}
+}
+
+func BenchmarkCopyAt(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	var dst interface {
+		image.Image
+		Set(x, y int, c color.Color)
+	} = randomRGBA(rng, 512, 512)
+	var src image.Image = randomRGBA(rng, 512, 512)
+	lines := benchLines(rng, 512, 512)
+	copyAt := func(x, y int) { dst.Set(x, y, src.At(x, y)) }
+	for b.Loop() {
+		for _, l := range lines {
+			bline(l[0], l[1], l[2], l[3], copyAt)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package sketch
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// A coverShape is a Shape that can be drawn anti-aliased, with -aa, or with
+// a -brush. Cover calls plot once for every pixel the shape covers at all,
+// with the fraction a of it covered.
+type coverShape interface {
+	Shape
+	Cover(plot func(x, y int, a float64))
+}
+
+// blend returns the premultiplied pixel p with c drawn over a fraction a of
+// it.
+func blend(p []uint8, c color.RGBA, a float64) color.RGBA {
+	mix := func(p, c uint8) uint8 {
+		return uint8(math.Round(float64(p) + a*(float64(c)-float64(p))))
+	}
+	return color.RGBA{mix(p[0], c.R), mix(p[1], c.G), mix(p[2], c.B), mix(p[3], c.A)}
+}
+
+// fade returns the premultiplied colour c at the given opacity.
+func fade(c color.RGBA, opacity float64) color.RGBA {
+	f := func(v uint8) uint8 { return uint8(math.Round(float64(v) * opacity)) }
+	return color.RGBA{f(c.R), f(c.G), f(c.B), f(c.A)}
+}
+
+// drawStroke draws s onto img as the sketch did: by its coverage if covered
+// is set, as with -aa or -brush, and at the given opacity.
+func drawStroke(img *image.RGBA, s stroke, covered bool, opacity float64) {
+	plot := func(x, y int, a float64) {
+		if (image.Point{x, y}.In(img.Rect)) {
+			i := img.PixOffset(x, y)
+			img.SetRGBA(x, y, blend(img.Pix[i:i+4:i+4], s.c, a*opacity))
+		}
+	}
+	if cs, ok := s.shape.(coverShape); ok && covered {
+		cs.Cover(plot)
+	} else if opacity < 1 {
+		s.shape.Rasterize(func(x, y int) { plot(x, y, 1) })
+	} else {
+		s.shape.Rasterize(func(x, y int) { img.SetRGBA(x, y, s.c) })
+	}
+}
+
+// Cover draws a one pixel wide line with Xiaolin Wu's algorithm, splitting
+// each step across the two pixels nearest the line, and a wide one with its
+// edge pixels covered by how far they reach inside it. With -brush, it
+// stamps the brush along the line instead.
+func (l *Line) Cover(plot func(x, y int, a float64)) {
+	if brushTip != nil {
+		l.brushCover(plot)
+		return
+	}
+	if l.W > 1 {
+		r := float64(l.W) / 2
+		l.footprint(r+0.5, func(x, y int, d float64) {
+			plot(x, y, math.Min(1, r+0.5-d))
+		})
+		return
+	}
+	x1, y1, x2, y2 := l.X1, l.Y1, l.X2, l.Y2
+	steep := iabs(y2-y1) > iabs(x2-x1)
+	if steep {
+		x1, y1, x2, y2 = y1, x1, y2, x2
+	}
+	if x1 > x2 {
+		x1, y1, x2, y2 = x2, y2, x1, y1
+	}
+	gradient := 0.0
+	if x2 > x1 {
+		gradient = float64(y2-y1) / float64(x2-x1)
+	}
+	for x := x1; x <= x2; x++ {
+		y := float64(y1) + gradient*float64(x-x1)
+		fy := math.Floor(y)
+		f := y - fy
+		for k, a := range [2]float64{1 - f, f} {
+			if a == 0 {
+				continue
+			}
+			if steep {
+				plot(int(fy)+k, x, a)
+			} else {
+				plot(x, int(fy)+k, a)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package sketch
+
+import (
+	"image"
+	"math"
+)
+
+// With -brush, lines are painted by stamping a brush tip image along them,
+// once a pixel, turned to follow the line. The tip covers the pixels under
+// it by its luminance, so that white paints in full and black not at all,
+// and a pixel under several stamps takes the most any gives it.
+
+// brushTip is the -brush image.
+var brushTip *image.Gray
+
+func loadBrush(name string) (*image.Gray, error) {
+	img, err := readImage(name)
+	if err != nil {
+		return nil, err
+	}
+	r := img.Bounds()
+	return scaledGray(img, r.Dx(), r.Dy()), nil
+}
+
+// brushCover calls plot for each pixel the brush covers when stamped along
+// the line.
+func (l *Line) brushCover(plot func(x, y int, a float64)) {
+	tip := brushTip
+	tw, th := tip.Rect.Dx(), tip.Rect.Dy()
+	ri := int(math.Ceil(math.Hypot(float64(tw), float64(th)) / 2))
+	dx, dy := float64(l.X2-l.X1), float64(l.Y2-l.Y1)
+	n := math.Hypot(dx, dy)
+	cos, sin := 1.0, 0.0
+	if n > 0 {
+		cos, sin = dx/n, dy/n
+	}
+
+	// Coverage of the line's bounding box, grown by the tip's reach.
+	x0, y0 := imin(l.X1, l.X2)-ri, imin(l.Y1, l.Y2)-ri
+	bw, bh := iabs(l.X2-l.X1)+2*ri+1, iabs(l.Y2-l.Y1)+2*ri+1
+	cov := make([]float64, bw*bh)
+	steps := int(n)
+	for k := 0; k <= steps; k++ {
+		cx, cy := float64(l.X1), float64(l.Y1)
+		if steps > 0 {
+			cx += dx * float64(k) / float64(steps)
+			cy += dy * float64(k) / float64(steps)
+		}
+		px0, py0 := int(math.Round(cx))-ri, int(math.Round(cy))-ri
+		for py := py0; py <= py0+2*ri; py++ {
+			for px := px0; px <= px0+2*ri; px++ {
+				// The pixel's place on the tip, turned back to upright.
+				ox, oy := float64(px)-cx, float64(py)-cy
+				tx := int(math.Floor(ox*cos + oy*sin + float64(tw)/2))
+				ty := int(math.Floor(-ox*sin + oy*cos + float64(th)/2))
+				if uint(tx) >= uint(tw) || uint(ty) >= uint(th) {
+					continue
+				}
+				i := (py-y0)*bw + px - x0
+				cov[i] = math.Max(cov[i], float64(tip.Pix[ty*tip.Stride+tx])/0xff)
+			}
+		}
+	}
+	for i, a := range cov {
+		if a > 0 {
+			plot(x0+i%bw, y0+i/bw, a)
+		}
+	}
+}
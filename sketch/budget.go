@@ -0,0 +1,36 @@
+package sketch
+
+import "math"
+
+// With -adaptive, -iter is the average number of iterations per frame
+// rather than a fixed number. Each frame gets a share in proportion to how
+// far its starting canvas is from its source, compared with the frames
+// before it, between a quarter and four times -iter. Shares are limited so
+// that the run as a whole never uses more than -iter times its number of
+// frames. Shares are worked out in frame order, as frames are read, so that
+// they don't depend on -jobs.
+
+// A budget tracks the iterations shared out so far.
+type budget struct {
+	Frames     int     `json:"frames"`
+	Allocated  int     `json:"allocated"`
+	Difficulty float64 `json:"difficulty"` // summed over the frames
+}
+
+// allocate returns the iterations for the next frame, whose canvas starts
+// at difficulty d from its source, and the budget after it.
+func (b budget) allocate(d float64) (int, budget) {
+	b.Frames++
+	b.Difficulty += d
+	share := float64(iterLimit)
+	if b.Difficulty > 0 {
+		share *= d * float64(b.Frames) / b.Difficulty
+	}
+	share = math.Max(float64(iterLimit)/4, math.Min(share, 4*float64(iterLimit)))
+	// At least one, as a frame given none would be sketched for all of
+	// -iter. The run's total still holds, as each frame has at least -iter
+	// left to it by those before.
+	n := imin(max(int(share), 1), iterLimit*b.Frames-b.Allocated)
+	b.Allocated += n
+	return n, b
+}
@@ -0,0 +1,25 @@
+package sketch
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	defer func(n int) { iterLimit = n }(iterLimit)
+	rng := rand.New(rand.NewSource(1))
+	for iterLimit = 1; iterLimit <= 100; iterLimit++ {
+		var b budget
+		total := 0
+		for f := 1; f <= 50; f++ {
+			var n int
+			n, b = b.allocate(rng.ExpFloat64())
+			if n < 1 {
+				t.Fatalf("-iter %d, frame %d: %d iterations", iterLimit, f, n)
+			}
+			if total += n; total > iterLimit*f {
+				t.Fatalf("-iter %d, frame %d: %d iterations in all", iterLimit, f, total)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package sketch
+
+import (
+	"image"
+	"log/slog"
+	"runtime"
+	"sync"
+)
+
+// With -camera, frames are grabbed from a camera by ffmpeg, through V4L2 on
+// Linux, AVFoundation on macOS or DirectShow on Windows, and sketched one
+// after another in -iter iterations each, each starting from the canvas of
+// the one before as with -warm, for a live sketch mirror. Of the frames the
+// camera takes while one is being sketched, only the latest is kept, so that
+// the sketch follows what is in front of the camera however long a frame
+// takes.
+
+// liveSource grabs frames from a camera, or the screen with -screen, keeping
+// only the latest.
+type liveSource struct {
+	v     *videoSource
+	fresh chan struct{} // signalled when img is replaced
+
+	mu  sync.Mutex
+	img image.Image // the latest frame
+	err error       // from grabbing the frame after img
+}
+
+func openCamera(device string) (*liveSource, error) {
+	var input []string
+	switch runtime.GOOS {
+	case "darwin":
+		input = []string{"-f", "avfoundation", "-i", device}
+	case "windows":
+		input = []string{"-f", "dshow", "-i", "video=" + device}
+	default:
+		input = []string{"-f", "v4l2", "-i", device}
+	}
+	c, err := openLive(input...)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("grabbing with ffmpeg", "camera", device)
+	return c, nil
+}
+
+// openLive starts grabbing frames from the input given by the ffmpeg options
+// in input.
+func openLive(input ...string) (*liveSource, error) {
+	v, err := decodeWithFFmpeg(input...)
+	if err != nil {
+		return nil, err
+	}
+	c := &liveSource{v: v, fresh: make(chan struct{}, 1)}
+	go c.grab()
+	return c, nil
+}
+
+// grab keeps the latest frame from ffmpeg until it stops.
+func (c *liveSource) grab() {
+	for {
+		img, err := c.v.next()
+		c.mu.Lock()
+		if err != nil {
+			c.err = err
+		} else {
+			c.img = img
+		}
+		c.mu.Unlock()
+		select {
+		case c.fresh <- struct{}{}:
+		default:
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// next returns the frame grabbed latest, waiting for one newer than the last
+// it returned.
+func (c *liveSource) next() (image.Image, error) {
+	<-c.fresh
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		c.fresh <- struct{}{} // for any call after
+		return nil, c.err
+	}
+	return c.img, nil
+}
+
+func (c *liveSource) close() error {
+	// ffmpeg grabs frames until it is stopped.
+	c.v.cmd.Process.Kill()
+	c.v.cmd.Wait()
+	return nil
+}
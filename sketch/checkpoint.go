@@ -0,0 +1,206 @@
+package sketch
+
+import (
+	"encoding/json"
+	"flag"
+	"image"
+	"image/color"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// With -checkpoint, the state of the frame being sketched is written to a
+// file every -checkpoint-interval, on an interrupt, and after each frame.
+// Running sketch with -resume and that file carries on from that point, with
+// the flags, seed and file arguments of the original run, and produces the
+// same frames as if it had never stopped.
+
+// A checkpoint records a run's progress. The fields after Frame describe the
+// frame in progress, and are zero if it has yet to be started.
+type checkpoint struct {
+	Seed      int64             `json:"seed"`
+	Flags     map[string]string `json:"flags"`
+	Args      []string          `json:"args,omitempty"`
+	FirstSave int               `json:"first_save"` // number of the first frame
+	IncrSaves int32             `json:"incr_saves"`
+	Frame     int               `json:"frame"` // index of the frame in progress
+
+	// With -warm, the previous frame, its background, and its strokes and
+	// those before it for -svg.
+	Warm        *rawImage  `json:"warm,omitempty"`
+	WarmBg      string     `json:"warm_bg,omitempty"`
+	WarmStrokes []logEntry `json:"warm_strokes,omitempty"`
+
+	// With -adaptive, the budget after the frame in progress was given its
+	// iterations, or after the frame before it if that has yet to happen.
+	Budget budget `json:"budget"`
+
+	Iter     int           `json:"iter,omitempty"`  // the last one done
+	Iters    int           `json:"iters,omitempty"` // with -adaptive
+	Draws    uint64        `json:"draws,omitempty"`
+	Accepted int           `json:"accepted,omitempty"`
+	Elapsed  time.Duration `json:"elapsed,omitempty"`
+	ErrSum   float64       `json:"err_sum,omitempty"`
+	Canvas   *rawImage     `json:"canvas,omitempty"`
+	Strokes  []logEntry    `json:"strokes,omitempty"`
+}
+
+// runState holds the parts of a checkpoint that are the same all run long.
+var runState checkpoint
+
+// checkpointMu serializes writes to the -checkpoint file.
+var checkpointMu sync.Mutex
+
+// setFlags returns the values of the flags set on the command line, other
+// than those in skip.
+func setFlags(skip map[string]bool) map[string]string {
+	flags := map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		if !skip[f.Name] {
+			flags[f.Name] = f.Value.String()
+		}
+	})
+	return flags
+}
+
+func loadCheckpoint(name string) (*checkpoint, error) {
+	f, err := openFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	cp := new(checkpoint)
+	if err := json.Unmarshal(b, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// writeCheckpoint writes cp to the -checkpoint file, replacing it only once
+// it has been written in full.
+func writeCheckpoint(cp *checkpoint) error {
+	checkpointMu.Lock()
+	defer checkpointMu.Unlock()
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if isObject(checkpointFile) {
+		// An object is only replaced once it has been uploaded in full.
+		w, err := createFile(checkpointFile)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	}
+	tmp := checkpointFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, checkpointFile)
+}
+
+// frameCheckpoint returns a checkpoint for the start of frame n, which with
+// -warm starts from warm on the background bg, and with -adaptive from the
+// budget bud.
+func frameCheckpoint(n int, warm *image.RGBA, warmStrokes []stroke, bg color.RGBA, bud budget) *checkpoint {
+	cp := runState
+	cp.IncrSaves = incrSaves.Load()
+	cp.Frame = n
+	cp.Budget = bud
+	if warm != nil {
+		raw := newRawImage(warm)
+		cp.Warm = &raw
+		cp.WarmBg = hexColor(bg)
+	}
+	for _, s := range warmStrokes {
+		cp.WarmStrokes = append(cp.WarmStrokes, strokeEntry(n, s))
+	}
+	return &cp
+}
+
+// warmState returns the -warm state recorded in cp.
+func (cp *checkpoint) warmState() (*image.RGBA, []stroke, color.RGBA, error) {
+	var bg color.RGBA
+	if cp.Warm == nil {
+		return nil, nil, bg, nil
+	}
+	img, err := cp.Warm.image()
+	if err != nil {
+		return nil, nil, bg, err
+	}
+	if bg, err = parseHexColor(cp.WarmBg); err != nil {
+		return nil, nil, bg, err
+	}
+	var strokes []stroke
+	for _, e := range cp.WarmStrokes {
+		s, err := entryStroke(e)
+		if err != nil {
+			return nil, nil, bg, err
+		}
+		strokes = append(strokes, s)
+	}
+	return img, strokes, bg, nil
+}
+
+// sketchCheckpoint returns a checkpoint for j, after iteration iter.
+func (j *job) sketchCheckpoint(iter, accepted int, elapsed time.Duration, errSum float64, canvas *image.RGBA, strokes []stroke) *checkpoint {
+	cp := frameCheckpoint(j.n, j.warm, j.warmStrokes, j.bg, j.budget)
+	cp.Iter = iter
+	cp.Iters = j.iters
+	cp.Draws = j.draws.n
+	cp.Accepted = accepted
+	cp.Elapsed = elapsed
+	cp.ErrSum = errSum
+	raw := newRawImage(canvas)
+	cp.Canvas = &raw
+	for _, s := range strokes {
+		cp.Strokes = append(cp.Strokes, strokeEntry(j.n, s))
+	}
+	return cp
+}
+
+// countingSource counts the values drawn from a rand.Source64, so that a
+// generator's state can be restored by replaying that many draws from its
+// seed.
+type countingSource struct {
+	src rand.Source64
+	n   uint64
+}
+
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{src: rand.NewSource(seed).(rand.Source64)}
+}
+
+func (s *countingSource) Int63() int64 {
+	s.n++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.n++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.n = 0
+}
+
+// skip draws values until n have been drawn.
+func (s *countingSource) skip(n uint64) {
+	for s.n < n {
+		s.Uint64()
+	}
+}
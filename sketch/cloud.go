@@ -0,0 +1,102 @@
+//go:build cloud
+
+package sketch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/gcsblob"
+	_ "gocloud.dev/blob/s3blob"
+	"gocloud.dev/gcerrors"
+)
+
+// buckets are the buckets opened so far, by their URL.
+var (
+	bucketsMu sync.Mutex
+	buckets   = map[string]*blob.Bucket{}
+)
+
+// openBucket returns the bucket of the object name, and the object's key in
+// it.
+func openBucket(name string) (*blob.Bucket, string, error) {
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, "", err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	u.Path = ""
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	b := buckets[u.String()]
+	if b == nil {
+		if b, err = blob.OpenBucket(context.Background(), u.String()); err != nil {
+			return nil, "", err
+		}
+		buckets[u.String()] = b
+	}
+	return b, key, nil
+}
+
+func openObject(name string) (io.ReadCloser, error) {
+	b, key, err := openBucket(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.NewReader(context.Background(), key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return r, nil
+}
+
+// createObject returns a writer for the object name, which is uploaded once
+// the writer is closed.
+func createObject(name string) (io.WriteCloser, error) {
+	b, key, err := openBucket(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.NewWriter(context.Background(), key, nil)
+}
+
+func objectExists(name string) (bool, error) {
+	b, key, err := openBucket(name)
+	if err != nil {
+		return false, err
+	}
+	return b.Exists(context.Background(), key)
+}
+
+// listObjects returns the names of the objects directly under dir.
+func listObjects(dir string) ([]string, error) {
+	b, prefix, err := openBucket(dir)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	var names []string
+	it := b.List(&blob.ListOptions{Prefix: prefix, Delimiter: "/"})
+	for {
+		obj, err := it.Next(context.Background())
+		if err == io.EOF {
+			return names, nil
+		}
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !obj.IsDir {
+			names = append(names, strings.TrimPrefix(obj.Key, prefix))
+		}
+	}
+}
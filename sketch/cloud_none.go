@@ -0,0 +1,26 @@
+//go:build !cloud
+
+package sketch
+
+import (
+	"errors"
+	"io"
+)
+
+var errNoCloud = errors.New("built without cloud storage, rebuild with -tags cloud")
+
+func openObject(name string) (io.ReadCloser, error) {
+	return nil, errNoCloud
+}
+
+func createObject(name string) (io.WriteCloser, error) {
+	return nil, errNoCloud
+}
+
+func objectExists(name string) (bool, error) {
+	return false, errNoCloud
+}
+
+func listObjects(dir string) ([]string, error) {
+	return nil, errNoCloud
+}
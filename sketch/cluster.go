@@ -0,0 +1,345 @@
+package sketch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// With -coordinator, sketch reads and writes frames as usual, but hands the
+// sketching out over HTTP to workers started with -worker. A worker asks
+// for a task, a run of up to taskFrames frames, fetches and sketches each
+// frame in turn, and posts it back. A frame that isn't returned within
+// -lease of when it could have been started is handed to the next worker
+// that asks, so a worker dying only costs the frames it was working on.
+//
+// The coordinator sends its sketching flags and seed along with each task,
+// and frames are seeded by their index as usual, so a frame comes out the
+// same whichever worker sketches it.
+
+// taskFrames is the most frames handed to a worker at once.
+const taskFrames = 4
+
+// coordFlags are the flags that configure the coordinator or worker
+// themselves, which aren't passed on to workers.
+var coordFlags = map[string]bool{"coordinator": true, "worker": true, "lease": true, "jobs": true, "seed": true, "logfile": true, "preview": true, "ndi": true, "rtmp": true}
+
+// A task is a run of frames for a worker to sketch.
+type task struct {
+	Frames []int             `json:"frames"`
+	Iters  []int             `json:"iters,omitempty"` // per frame, with -adaptive
+	Seed   int64             `json:"seed"`
+	Flags  map[string]string `json:"flags"`
+}
+
+// A rawImage is an image.RGBA as sent over the wire. Unlike PNG, it keeps
+// premultiplied pixels exact.
+type rawImage struct {
+	W   int    `json:"w"`
+	H   int    `json:"h"`
+	Pix []byte `json:"pix"`
+}
+
+func newRawImage(img image.Image) rawImage {
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rawImage{b.Dx(), b.Dy(), rgba.Pix}
+}
+
+func (r rawImage) image() (*image.RGBA, error) {
+	if r.W < 0 || r.H < 0 || len(r.Pix) != 4*r.W*r.H {
+		return nil, errors.New("invalid raw image")
+	}
+	return &image.RGBA{Pix: r.Pix, Stride: 4 * r.W, Rect: image.Rect(0, 0, r.W, r.H)}, nil
+}
+
+// A result is a sketched frame, posted back by a worker.
+type result struct {
+	Image   rawImage   `json:"image"`
+	Strokes []logEntry `json:"strokes,omitempty"`
+	Log     string     `json:"log,omitempty"`
+}
+
+// A remoteFrame is a frame waiting for, or being sketched by, a worker.
+type remoteFrame struct {
+	j        *job
+	src      rawImage
+	release  func()
+	worker   string // empty while waiting
+	deadline time.Time
+}
+
+type coordinator struct {
+	seed  int64
+	flags map[string]string
+
+	mu     sync.Mutex
+	frames map[int]*remoteFrame
+	queue  []int // waiting frames, in order
+	closed bool  // set once all frames have been added
+}
+
+// listenCoordinator starts serving tasks on addr.
+func listenCoordinator(addr string, seed int64) (*coordinator, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &coordinator{seed: seed, flags: setFlags(coordFlags), frames: map[int]*remoteFrame{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /task", c.serveTask)
+	mux.HandleFunc("GET /frame/{n}", c.serveFrame)
+	mux.HandleFunc("POST /result/{n}", c.serveResult)
+	slog.Info("coordinating workers", "addr", ln.Addr())
+	go func() {
+		log.Fatalln(http.Serve(ln, mux))
+	}()
+	return c, nil
+}
+
+// add queues j, frame n, for a worker. release is called once it is done.
+func (c *coordinator) add(n int, j *job, release func()) {
+	f := &remoteFrame{j: j, src: newRawImage(j.src), release: release}
+	j.src = nil
+	c.mu.Lock()
+	c.frames[n] = f
+	c.queue = append(c.queue, n)
+	c.mu.Unlock()
+}
+
+// close marks the end of the frames.
+func (c *coordinator) close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+}
+
+// requeue puts frames whose lease has expired back in the queue.
+func (c *coordinator) requeue(now time.Time) {
+	for n, f := range c.frames {
+		if f.worker != "" && now.After(f.deadline) {
+			slog.Warn("frame not returned, reassigning", "frame", n, "worker", f.worker)
+			f.worker = ""
+			c.queue = append(c.queue, n)
+		}
+	}
+	sort.Ints(c.queue)
+}
+
+func (c *coordinator) serveTask(w http.ResponseWriter, r *http.Request) {
+	worker := r.FormValue("worker")
+	if worker == "" {
+		worker = r.RemoteAddr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.requeue(now)
+	if len(c.queue) == 0 {
+		if c.closed && len(c.frames) == 0 {
+			w.WriteHeader(http.StatusGone)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+	t := task{Seed: c.seed, Flags: c.flags}
+	for len(c.queue) > 0 && len(t.Frames) < taskFrames {
+		n := c.queue[0]
+		c.queue = c.queue[1:]
+		f := c.frames[n]
+		f.worker = worker
+		f.deadline = now.Add(time.Duration(len(t.Frames)+1) * lease)
+		t.Frames = append(t.Frames, n)
+		t.Iters = append(t.Iters, f.j.iters)
+	}
+	slog.Debug("frames assigned", "frames", t.Frames, "worker", worker)
+	json.NewEncoder(w).Encode(t)
+}
+
+func (c *coordinator) serveFrame(w http.ResponseWriter, r *http.Request) {
+	n, _ := strconv.Atoi(r.PathValue("n"))
+	c.mu.Lock()
+	f := c.frames[n]
+	c.mu.Unlock()
+	if f == nil {
+		http.Error(w, "no such frame", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(f.src)
+}
+
+func (c *coordinator) serveResult(w http.ResponseWriter, r *http.Request) {
+	var res result
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	img, err := res.Image.image()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	strokes := make([]stroke, len(res.Strokes))
+	for i, e := range res.Strokes {
+		if strokes[i], err = entryStroke(e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	n, _ := strconv.Atoi(r.PathValue("n"))
+	c.mu.Lock()
+	f := c.frames[n]
+	if f == nil {
+		// Already returned by a worker that was thought to have died.
+		c.mu.Unlock()
+		return
+	}
+	delete(c.frames, n)
+	for i, m := range c.queue {
+		if m == n {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	slog.Debug("frame returned", "frame", n, "worker", r.FormValue("worker"))
+	f.j.buf.WriteString(res.Log)
+	f.j.img, f.j.strokes = img, strokes
+	close(f.j.done)
+	f.release()
+}
+
+// work implements -worker, sketching frames for the coordinator at url
+// until it has none left.
+func work(url string) {
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("%s-%d", host, os.Getpid())
+	q := "?worker=" + name
+	configured := false
+	for {
+		resp, err := http.Post(url+"/task"+q, "", nil)
+		if err != nil && configured {
+			// The coordinator exits once the last frame is written.
+			slog.Info("coordinator gone", "err", err)
+			return
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		var t task
+		switch resp.StatusCode {
+		case http.StatusOK:
+			err = json.NewDecoder(resp.Body).Decode(&t)
+		case http.StatusNoContent:
+			resp.Body.Close()
+			time.Sleep(time.Second)
+			continue
+		case http.StatusGone:
+			resp.Body.Close()
+			slog.Info("no frames left")
+			return
+		default:
+			err = fmt.Errorf("task: %s", resp.Status)
+		}
+		resp.Body.Close()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if !configured {
+			configure(t.Flags)
+			setupLogging()
+			if err := setupSketch(); err != nil {
+				log.Fatalln(err)
+			}
+			configured = true
+		}
+
+		for i, n := range t.Frames {
+			var src rawImage
+			if err := getJSON(url+"/frame/"+strconv.Itoa(n), &src); err != nil {
+				log.Fatalln(err)
+			}
+			img, err := src.image()
+			if err != nil {
+				log.Fatalln(err)
+			}
+			slog.Info("sketching", "frame", n)
+			j := newJob(n, img, 0, t.Seed, true)
+			if i < len(t.Iters) {
+				j.iters = t.Iters[i]
+			}
+			j.run()
+			if interrupted.Load() {
+				slog.Warn("interrupted, frame left for another worker", "frame", n)
+				return
+			}
+			res := result{Image: newRawImage(j.img), Log: j.buf.String()}
+			for _, s := range j.strokes {
+				res.Strokes = append(res.Strokes, strokeEntry(n, s))
+			}
+			if err := postJSON(url+"/result/"+strconv.Itoa(n)+q, res); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	}
+}
+
+// configure sets flags from a coordinator or checkpoint, except for any set
+// on the command line.
+func configure(flags map[string]string) {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, value := range flags {
+		if set[name] || coordFlags[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
+
+func getJSON(url string, v any) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func postJSON(url string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package sketch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// With -control, sketch listens on the given address, or on a Unix socket
+// with unix:path, for changes to -l, -save, -alpha, -iter, -colors and -rate
+// while it runs, so that a long run can be tuned without starting it again.
+// GET /params returns the values in use, and POST /params with any of l,
+// save, alpha, iter, colors and rate as query parameters changes them, from
+// the sketch loop's next check. -osc and -midi change them too.
+
+// control takes changes from -control, -osc and -midi, if any of them is
+// set.
+var control *controller
+
+// A controller holds the changes asked for until the sketch loop takes them.
+type controller struct {
+	mu      sync.Mutex
+	params  controlParams  // in use
+	pending *controlParams // to be taken, if not nil
+	changed atomic.Bool    // whether pending is set
+}
+
+// controlParams are the flags -control can change.
+type controlParams struct {
+	LineLen      int     `json:"l"`
+	SaveInterval float64 `json:"save"`
+	Alpha        int     `json:"alpha"`
+	IterLimit    int     `json:"iter"`
+	Colors       int     `json:"colors"`
+	Rate         float64 `json:"rate"`
+}
+
+func newController() *controller {
+	return &controller{params: controlParams{lineLen, saveInterval, strokeAlpha, iterLimit, numColors, iterRate}}
+}
+
+// listen starts serving -control for c on addr.
+func (c *controller) listen(addr string) error {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// A socket left behind by an earlier run would keep this one from
+		// listening.
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		network, addr = "unix", path
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /params", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		p := c.params
+		c.mu.Unlock()
+		writeParams(w, p)
+	})
+	mux.HandleFunc("POST /params", c.change)
+	slog.Info("listening for control", "addr", ln.Addr())
+	go func() {
+		log.Fatalln(http.Serve(ln, mux))
+	}()
+	return nil
+}
+
+// change queues the changes in r's query, and sends back the parameters as
+// they will be once they are taken.
+func (c *controller) change(w http.ResponseWriter, r *http.Request) {
+	p, err := c.queue(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeParams(w, p)
+}
+
+// queue queues the changes in q, and returns the parameters as they will be
+// once they are taken.
+func (c *controller) queue(q url.Values) (controlParams, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := c.params
+	if c.pending != nil {
+		p = *c.pending
+	}
+	if err := p.set(q); err != nil {
+		return controlParams{}, err
+	}
+	c.pending = &p
+	c.changed.Store(true)
+	return p, nil
+}
+
+// set changes p by the values in q, checking them as run does their flags.
+func (p *controlParams) set(q url.Values) error {
+	for name, vs := range q {
+		v := vs[len(vs)-1]
+		var err error
+		switch name {
+		case "l":
+			if p.LineLen, err = strconv.Atoi(v); err == nil && p.LineLen < 1 {
+				err = fmt.Errorf("bad line length %d", p.LineLen)
+			}
+		case "save":
+			p.SaveInterval, err = strconv.ParseFloat(v, 64)
+			if err == nil && compareOutput && p.SaveInterval <= 0 {
+				err = errors.New("-compare needs -save")
+			}
+		case "alpha":
+			if p.Alpha, err = strconv.Atoi(v); err == nil && (p.Alpha < 1 || p.Alpha > 255) {
+				err = fmt.Errorf("bad stroke alpha %d", p.Alpha)
+			}
+			if err == nil && useGPU && p.Alpha < 255 {
+				err = errors.New("only opaque strokes are scored on the GPU")
+			}
+		case "iter":
+			p.IterLimit, err = strconv.Atoi(v)
+			if err == nil && adaptive {
+				err = errors.New("-adaptive shares out the -iter limit it started with")
+			}
+		case "colors":
+			if p.Colors, err = strconv.Atoi(v); err == nil && p.Colors < 0 {
+				err = fmt.Errorf("bad number of colours %d", p.Colors)
+			}
+			if err == nil && (colorMode != "palette" || hatchPasses > 0 || inkFlag != "") {
+				err = errors.New("-colors only applies to strokes coloured from a palette")
+			}
+		case "rate":
+			if p.Rate, err = strconv.ParseFloat(v, 64); err == nil && p.Rate < 0 {
+				err = fmt.Errorf("bad iteration rate %g", p.Rate)
+			}
+		default:
+			err = fmt.Errorf("unknown parameter %q", name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// take returns the changes queued since it was last called, if there are
+// any, as the parameters in use from then on.
+func (c *controller) take() (controlParams, bool) {
+	if !c.changed.Load() {
+		return controlParams{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.params, c.pending = *c.pending, nil
+	c.changed.Store(false)
+	return c.params, true
+}
+
+func writeParams(w http.ResponseWriter, p controlParams) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,98 @@
+package sketch
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// With -crop x,y,w,h, only that rectangle of each source is sketched, which
+// is w by h pixels from x across and y down, or any of them can be a
+// percentage of the source's width or height, such as 25%,25%,50%,50% for
+// the middle of it. A rectangle reaching past the edge of a source is cut
+// short at it. The frames written are of the rectangle, or with
+// -crop-composite, of the whole source with the sketch of the rectangle
+// drawn over it. The SVG of -svg and the frames of -strokelog are of the
+// rectangle either way.
+
+// A cropSpec is a parsed -crop rectangle.
+type cropSpec struct {
+	v   [4]float64 // x, y, w and h
+	pct [4]bool    // whether each of v is a percentage
+}
+
+// cropArea is the -crop rectangle, or nil for all of each source.
+var cropArea *cropSpec
+
+// parseCrop parses the -crop flag.
+func parseCrop(s string) (*cropSpec, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid crop %q, want x,y,w,h", s)
+	}
+	c := &cropSpec{}
+	for i, p := range parts {
+		p, c.pct[i] = strings.CutSuffix(strings.TrimSpace(p), "%")
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 || i >= 2 && v == 0 || c.pct[i] && v > 100 {
+			return nil, fmt.Errorf("invalid crop %q", s)
+		}
+		c.v[i] = v
+	}
+	return c, nil
+}
+
+// rect returns the rectangle c covers of b.
+func (c *cropSpec) rect(b image.Rectangle) image.Rectangle {
+	var n [4]int
+	for i, v := range c.v {
+		if c.pct[i] {
+			size := b.Dx()
+			if i%2 == 1 {
+				size = b.Dy()
+			}
+			v *= float64(size) / 100
+		}
+		n[i] = int(v + 0.5)
+	}
+	r := image.Rect(n[0], n[1], n[0]+max(n[2], 1), n[1]+max(n[3], 1))
+	return r.Add(b.Min).Intersect(b)
+}
+
+// cropSource returns the -crop rectangle of src, and where in src it is.
+func cropSource(src image.Image) (image.Image, image.Rectangle, error) {
+	b := src.Bounds()
+	if cropArea == nil {
+		return src, b, nil
+	}
+	r := cropArea.rect(b)
+	if r.Empty() {
+		return nil, r, fmt.Errorf("-crop lies outside a source of %dx%d", b.Dx(), b.Dy())
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Rect, src, r.Min, draw.Src)
+	return dst, r, nil
+}
+
+// composite returns full with img, its sketch of the rectangle r of it,
+// drawn over that rectangle, scaled up to fill it if it was sketched
+// smaller.
+func composite(full image.Image, r image.Rectangle, img *image.RGBA) *image.RGBA {
+	b := full.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Rect, full, b.Min, draw.Src)
+	dr := r.Sub(b.Min)
+	if img.Rect.Size() == dr.Size() {
+		draw.Draw(out, dr, img, image.Point{}, draw.Src)
+	} else {
+		xdraw.CatmullRom.Scale(out, dr, img, img.Rect, draw.Src, nil)
+	}
+	return out
+}
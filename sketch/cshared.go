@@ -0,0 +1,122 @@
+//go:build cshared
+
+package sketch
+
+/*
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"image"
+	"image/draw"
+	"log/slog"
+	"unsafe"
+)
+
+// Built with -tags cshared -buildmode=c-shared, sketch is a C library, with
+// the functions declared in sketch.h, for other languages to sketch images
+// in-process. Images are passed as 8 bit RGBA pixels, not premultiplied, row
+// after row with no padding, like the data of an HTML ImageData.
+
+// libJobs and libNext are guarded by libMu.
+var libJobs = map[C.int]*job{}
+var libNext C.int = 1
+
+func init() {
+	setupLogging()
+}
+
+// libStart returns a job for the w by h image at rgba, or false, having
+// logged why, if the image or the flags are bad.
+func libStart(rgba *C.uint8_t, w, h C.int) (*job, bool) {
+	if rgba == nil || w < 1 || h < 1 {
+		return nil, false
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, int(w), int(h)))
+	copy(img.Pix, unsafe.Slice((*byte)(rgba), len(img.Pix)))
+	j, err := newLibJob(img)
+	if err != nil {
+		slog.Error("can't sketch", "err", err)
+		return nil, false
+	}
+	return j, true
+}
+
+// libCopy copies canvas to the RGBA pixels at out.
+func libCopy(out *C.uint8_t, canvas *image.RGBA) {
+	img := image.NewNRGBA(canvas.Rect)
+	draw.Draw(img, img.Rect, canvas, image.Point{}, draw.Src)
+	copy(unsafe.Slice((*byte)(out), len(img.Pix)), img.Pix)
+}
+
+//export SketchSetFlag
+func SketchSetFlag(name, value *C.char) C.int {
+	if err := SetFlag(C.GoString(name), C.GoString(value)); err != nil {
+		slog.Error("bad flags", "err", err)
+		return -1
+	}
+	return 0
+}
+
+//export SketchImage
+func SketchImage(rgba *C.uint8_t, w, h, iters C.int, out *C.uint8_t) C.int {
+	j, ok := libStart(rgba, w, h)
+	if !ok {
+		return -1
+	}
+	j.iters = int(iters)
+	j.run()
+	libCopy(out, j.img)
+	return 0
+}
+
+//export SketchNew
+func SketchNew(rgba *C.uint8_t, w, h C.int) C.int {
+	j, ok := libStart(rgba, w, h)
+	if !ok {
+		return -1
+	}
+	j.startSteps()
+	go j.run()
+	libMu.Lock()
+	defer libMu.Unlock()
+	id := libNext
+	libNext++
+	libJobs[id] = j
+	return id
+}
+
+// libJob returns the job for handle id, or nil.
+func libJob(id C.int) *job {
+	libMu.Lock()
+	defer libMu.Unlock()
+	return libJobs[id]
+}
+
+//export SketchStep
+func SketchStep(id, n C.int, out *C.uint8_t) C.int {
+	j := libJob(id)
+	if j == nil || n < 1 {
+		return -1
+	}
+	canvas, more := j.step(int(n))
+	if out != nil {
+		libCopy(out, canvas)
+	}
+	if !more {
+		return 0
+	}
+	return 1
+}
+
+//export SketchFree
+func SketchFree(id C.int) {
+	libMu.Lock()
+	j := libJobs[id]
+	delete(libJobs, id)
+	libMu.Unlock()
+	if j != nil {
+		j.stop()
+	}
+}
@@ -0,0 +1,64 @@
+package sketch
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// A distAcc sums the colour distance between a plane and a single colour
+// over a run of pixels, like repeated calls to calcdiff. Pixel offsets are
+// buffered, so that distsum can handle them in bulk with SIMD instructions
+// where the CPU has them.
+type distAcc struct {
+	p   *plane
+	c   [4]float64
+	sum float64
+	n   int
+	buf [64]int32
+}
+
+func newDistAcc(p *plane, c color.RGBA) distAcc {
+	return distAcc{p: p, c: colorSamples(c)}
+}
+
+// add adds the distance at (x, y), if it is inside the plane.
+func (d *distAcc) add(x, y int) {
+	if !(image.Point{x, y}.In(d.p.Rect)) {
+		return
+	}
+	d.buf[d.n] = int32(d.p.PixOffset(x, y))
+	d.n++
+	if d.n == len(d.buf) {
+		d.flush()
+	}
+}
+
+func (d *distAcc) flush() {
+	d.sum = distsum(d.sum, d.p.Pix, d.buf[:d.n], &d.c)
+	d.n = 0
+}
+
+// total returns the sum of the distances added so far.
+func (d *distAcc) total() float64 {
+	d.flush()
+	return d.sum
+}
+
+// distsumGo is the portable version of distsum. Each distance is added to
+// sum in turn, so every implementation returns exactly the same result;
+// the squared distances are sums of integers well below 2^53, so the order
+// the channels are added in doesn't matter. With -metric lab or linear, or
+// -weights other than all 1, the samples aren't integers, and results may
+// differ in the last bits.
+func distsumGo(sum float64, pix []float32, offs []int32, c *[4]float64) float64 {
+	for _, i := range offs {
+		p := pix[i : i+4 : i+4]
+		R := float64(p[0]) - c[0]
+		G := float64(p[1]) - c[1]
+		B := float64(p[2]) - c[2]
+		A := float64(p[3]) - c[3]
+		sum += math.Sqrt(R*R + G*G + B*B + A*A)
+	}
+	return sum
+}
@@ -0,0 +1,20 @@
+//go:build !opencl && !cshared && !ndi
+
+package sketch
+
+import "golang.org/x/sys/cpu"
+
+var useAVX = cpu.X86.HasAVX
+
+// distsumAVX is distsumGo using AVX. The offsets must be within pix.
+//
+//go:noescape
+func distsumAVX(sum float64, pix []float32, offs []int32, c *[4]float64) float64
+
+// distsum is distsumAVX where the CPU has AVX.
+func distsum(sum float64, pix []float32, offs []int32, c *[4]float64) float64 {
+	if useAVX {
+		return distsumAVX(sum, pix, offs, c)
+	}
+	return distsumGo(sum, pix, offs, c)
+}
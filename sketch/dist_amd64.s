@@ -0,0 +1,34 @@
+//go:build !opencl && !cshared && !ndi
+
+#include "textflag.h"
+
+// func distsumAVX(sum float64, pix []float32, offs []int32, c *[4]float64) float64
+TEXT ·distsumAVX(SB), NOSPLIT, $0-72
+	MOVSD	sum+0(FP), X0
+	MOVQ	pix_base+8(FP), SI
+	MOVQ	offs_base+32(FP), DI
+	MOVQ	offs_len+40(FP), CX
+	MOVQ	c+56(FP), DX
+	VMOVUPD	(DX), Y1
+	TESTQ	CX, CX
+	JZ	done
+
+loop:
+	MOVLQSX	(DI), AX
+	VCVTPS2PD	(SI)(AX*4), Y2	// R G B A
+	VSUBPD	Y1, Y2, Y2
+	VMULPD	Y2, Y2, Y2
+	VEXTRACTF128	$1, Y2, X3
+	VADDPD	X3, X2, X2	// R+B G+A
+	VUNPCKHPD	X2, X2, X3
+	VADDSD	X3, X2, X2
+	VSQRTSD	X2, X2, X2
+	VADDSD	X2, X0, X0
+	ADDQ	$4, DI
+	DECQ	CX
+	JNZ	loop
+
+done:
+	VZEROUPPER
+	MOVSD	X0, ret+64(FP)
+	RET
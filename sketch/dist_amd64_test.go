@@ -0,0 +1,12 @@
+//go:build !opencl && !cshared && !ndi
+
+package sketch
+
+import "testing"
+
+func TestDistsumAVX(t *testing.T) {
+	if !useAVX {
+		t.Skip("no AVX")
+	}
+	testDistsum(t, distsumAVX)
+}
@@ -0,0 +1,20 @@
+//go:build !opencl && !cshared && !ndi
+
+package sketch
+
+import "golang.org/x/sys/cpu"
+
+var useNEON = cpu.ARM64.HasASIMD
+
+// distsumNEON is distsumGo using NEON. The offsets must be within pix.
+//
+//go:noescape
+func distsumNEON(sum float64, pix []float32, offs []int32, c *[4]float64) float64
+
+// distsum is distsumNEON where the CPU has NEON.
+func distsum(sum float64, pix []float32, offs []int32, c *[4]float64) float64 {
+	if useNEON {
+		return distsumNEON(sum, pix, offs, c)
+	}
+	return distsumGo(sum, pix, offs, c)
+}
@@ -0,0 +1,35 @@
+//go:build !opencl && !cshared && !ndi
+
+#include "textflag.h"
+
+// func distsumNEON(sum float64, pix []float32, offs []int32, c *[4]float64) float64
+TEXT ·distsumNEON(SB), NOSPLIT, $0-72
+	FMOVD	sum+0(FP), F7
+	MOVD	pix_base+8(FP), R0
+	MOVD	offs_base+32(FP), R1
+	MOVD	offs_len+40(FP), R2
+	MOVD	c+56(FP), R3
+	VLD1	(R3), [V0.D2, V1.D2]
+	CBZ	R2, done
+
+loop:
+	MOVW.P	4(R1), R4
+	ADD	R4<<2, R0, R5
+	VLD1	(R5), [V2.S4]	// R G B A
+	VFCVTL	V2.S2, V3.D2
+	VFCVTL2	V2.S4, V4.D2
+	VFSUB	V0.D2, V3.D2, V3.D2
+	VFSUB	V1.D2, V4.D2, V4.D2
+	VFMUL	V3.D2, V3.D2, V3.D2
+	VFMUL	V4.D2, V4.D2, V4.D2
+	VFADD	V4.D2, V3.D2, V3.D2	// R+B G+A
+	VMOV	V3.D[1], V5.D[0]
+	FADDD	F5, F3, F3
+	FSQRTD	F3, F3
+	FADDD	F3, F7
+	SUB	$1, R2
+	CBNZ	R2, loop
+
+done:
+	FMOVD	F7, ret+64(FP)
+	RET
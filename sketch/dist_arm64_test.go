@@ -0,0 +1,12 @@
+//go:build !opencl && !cshared && !ndi
+
+package sketch
+
+import "testing"
+
+func TestDistsumNEON(t *testing.T) {
+	if !useNEON {
+		t.Skip("no NEON")
+	}
+	testDistsum(t, distsumNEON)
+}
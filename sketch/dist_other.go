@@ -0,0 +1,12 @@
+//go:build (!amd64 && !arm64) || opencl || cshared || ndi
+
+package sketch
+
+// Go assembly can't be mixed with cgo, so builds with the opencl, cshared or
+// ndi tags use the portable version too.
+
+// distsum adds the distance between c and the plane pixel at each offset
+// in offs to sum.
+func distsum(sum float64, pix []float32, offs []int32, c *[4]float64) float64 {
+	return distsumGo(sum, pix, offs, c)
+}
@@ -0,0 +1,53 @@
+package sketch
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testDistsum checks that f adds up the same distances as distsumGo, for
+// runs of offsets of every length up to a few dozen, starting anywhere in
+// the offsets and pointing anywhere in the plane. With integer samples, as
+// with -metric rgb, the sums must be exactly the same; otherwise they may
+// differ in the last bits.
+func testDistsum(t *testing.T, f func(float64, []float32, []int32, *[4]float64) float64) {
+	rng := rand.New(rand.NewSource(1))
+	for _, integer := range []bool{true, false} {
+		pix := make([]float32, 4*1000)
+		for i := range pix {
+			pix[i] = float32(rng.Intn(256))
+			if !integer {
+				pix[i] += rng.Float32()
+			}
+		}
+		offs := make([]int32, 100)
+		for i := range offs {
+			// Not only the starts of pixels.
+			offs[i] = int32(rng.Intn(len(pix) - 3))
+		}
+		for n := 0; n <= 40; n++ {
+			for k := 0; k < 8; k++ {
+				start := rng.Intn(len(offs) - n + 1)
+				o := offs[start : start+n]
+				c := [4]float64{float64(rng.Intn(256)), float64(rng.Intn(256)), float64(rng.Intn(256)), float64(rng.Intn(256))}
+				sum := float64(rng.Intn(1000))
+				if !integer {
+					for i := range c {
+						c[i] += rng.Float64()
+					}
+					sum += rng.Float64()
+				}
+				want := distsumGo(sum, pix, o, &c)
+				got := f(sum, pix, o, &c)
+				if integer && got != want || math.Abs(got-want) > 1e-9*want {
+					t.Fatalf("integer %t, %d offsets from %d: got %v, want %v", integer, n, start, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestDistsum(t *testing.T) {
+	testDistsum(t, distsum)
+}
@@ -0,0 +1,46 @@
+package sketch
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// With -duotone, the source is first mapped by brightness onto the ramp
+// from one colour to another, which is then sketched in place of the
+// source, so that strokes only take colours from the ramp.
+
+// duotone is the ramp of -duotone, from dark to light.
+var duotone [2]color.RGBA
+
+// parseDuotone parses the -duotone flag, two inks separated by a comma.
+func parseDuotone(s string) ([2]color.RGBA, error) {
+	var ramp [2]color.RGBA
+	dark, light, ok := strings.Cut(s, ",")
+	if !ok {
+		return ramp, fmt.Errorf("invalid duotone %q", s)
+	}
+	var err error
+	if ramp[0], err = parseInk(dark); err != nil {
+		return ramp, err
+	}
+	if ramp[1], err = parseInk(light); err != nil {
+		return ramp, err
+	}
+	return ramp, nil
+}
+
+// duotoned returns img mapped onto the -duotone ramp.
+func duotoned(img *image.RGBA) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	dark := []uint8{duotone[0].R, duotone[0].G, duotone[0].B, duotone[0].A}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			t := luma(img.RGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)) / 0xff
+			out.SetRGBA(x, y, blend(dark, duotone[1], t))
+		}
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package sketch
+
+import (
+	"image"
+	"math"
+)
+
+// sobel returns the Sobel gradient of colour channel c of img at (x, y).
+// Pixels beyond the border repeat the edge ones.
+func sobel(img *image.RGBA, c, x, y int) (gx, gy float64) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	at := func(x, y int) float64 {
+		x = imin(imax(x, 0), w-1)
+		y = imin(imax(y, 0), h-1)
+		return float64(img.Pix[y*img.Stride+4*x+c])
+	}
+	gx = at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) -
+		at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+	gy = at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) -
+		at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+	return gx, gy
+}
+
+// edgeMagnitude returns the Sobel gradient magnitude of img at each pixel,
+// in row order, summed over the colour channels and scaled so that the
+// strongest edge is 1.
+func edgeMagnitude(img *image.RGBA) []float64 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	mag := make([]float64, w*h)
+	var max float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum float64
+			for c := 0; c < 3; c++ {
+				sum += math.Hypot(sobel(img, c, x, y))
+			}
+			mag[y*w+x] = sum
+			max = math.Max(max, sum)
+		}
+	}
+	if max > 0 {
+		for i := range mag {
+			mag[i] /= max
+		}
+	}
+	return mag
+}
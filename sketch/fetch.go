@@ -0,0 +1,48 @@
+package sketch
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Image files named on the command line, and by -init, -mask, -weight,
+// -palette-from and -brush, may be http or https URLs instead, which are
+// downloaded as they are read.
+
+// fetchTimeout is the longest a download may take, from connecting to
+// reading the last byte.
+const fetchTimeout = time.Minute
+
+var fetchClient = &http.Client{Timeout: fetchTimeout}
+
+// isURL reports whether name is an http or https URL.
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// openImage opens the named image file or object, or downloads it if name is
+// a URL.
+func openImage(name string) (io.ReadCloser, error) {
+	if !isURL(name) {
+		return openFile(name)
+	}
+	resp, err := fetchClient.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", name, resp.Status)
+	}
+	// Servers that don't know what they are sending say octet-stream, and
+	// the image is then left to the decoders to recognise.
+	ct := resp.Header.Get("Content-Type")
+	if ct != "" && !strings.HasPrefix(ct, "image/") && !strings.HasPrefix(ct, "application/octet-stream") {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: not an image, but %s", name, ct)
+	}
+	return resp.Body, nil
+}
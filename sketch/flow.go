@@ -0,0 +1,91 @@
+package sketch
+
+import (
+	"image"
+	"math"
+)
+
+// A flowField holds the orientation of the contours in a source, which with
+// -flow lines are turned to follow. The orientation comes from the Sobel
+// gradients, summed over the colour channels as a structure tensor and
+// averaged over a neighbourhood, so that it runs smoothly along an edge
+// rather than following every bit of noise.
+type flowField struct {
+	angle     []float64 // of the contour at each pixel, in row order
+	coherence []float64 // from 0 where there is no one orientation, to 1
+}
+
+func newFlowField(img *image.RGBA, r int) *flowField {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	jxx, jyy, jxy := make([]float64, w*h), make([]float64, w*h), make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			for c := 0; c < 3; c++ {
+				gx, gy := sobel(img, c, x, y)
+				jxx[i] += gx * gx
+				jyy[i] += gy * gy
+				jxy[i] += gx * gy
+			}
+		}
+	}
+	boxBlur(jxx, w, h, r)
+	boxBlur(jyy, w, h, r)
+	boxBlur(jxy, w, h, r)
+	f := &flowField{make([]float64, w*h), make([]float64, w*h)}
+	for i := range f.angle {
+		// The gradient lies along the tensor's major axis, and the
+		// contour across it.
+		f.angle[i] = 0.5*math.Atan2(2*jxy[i], jxx[i]-jyy[i]) + math.Pi/2
+		if tr := jxx[i] + jyy[i]; tr > 0 {
+			f.coherence[i] = math.Hypot(jxx[i]-jyy[i], 2*jxy[i]) / tr
+		}
+	}
+	return f
+}
+
+// boxBlur replaces each of the w by h values in v with the mean of those
+// within r of it in each direction.
+func boxBlur(v []float64, w, h, r int) {
+	tmp := make([]float64, imax(w, h))
+	blur := func(n int, at func(i int) *float64) {
+		var sum float64
+		for i := 0; i < n; i++ {
+			tmp[i] = *at(i)
+		}
+		for i := 0; i < imin(r, n); i++ {
+			sum += tmp[i]
+		}
+		for i := 0; i < n; i++ {
+			if i+r < n {
+				sum += tmp[i+r]
+			}
+			if i-r-1 >= 0 {
+				sum -= tmp[i-r-1]
+			}
+			*at(i) = sum / float64(imin(i+r, n-1)-imax(i-r, 0)+1)
+		}
+	}
+	for y := 0; y < h; y++ {
+		blur(w, func(i int) *float64 { return &v[y*w+i] })
+	}
+	for x := 0; x < w; x++ {
+		blur(h, func(i int) *float64 { return &v[i*w+x] })
+	}
+}
+
+// turn turns the offset (dx, dy) of a line starting at pixel i toward the
+// contour there, or across it with -flow-cross, by -flow times the field's
+// coherence, keeping its length.
+func (f *flowField) turn(i, dx, dy int) (int, int) {
+	target := f.angle[i]
+	if flowCross {
+		target += math.Pi / 2
+	}
+	k := flowStrength * f.coherence[i]
+	n := math.Hypot(float64(dx), float64(dy))
+	d := math.Atan2(float64(dy), float64(dx)) - target
+	d -= math.Pi * math.Round(d/math.Pi) // lines have no direction
+	a := target + (1-k)*d
+	return int(math.Round(n * math.Cos(a))), int(math.Round(n * math.Sin(a)))
+}
@@ -0,0 +1,83 @@
+package sketch
+
+import (
+	"bufio"
+	"fmt"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// formatExt maps -format names to file name extensions.
+var formatExt = map[string]string{
+	"png":  "png",
+	"jpeg": "jpg",
+	"webp": "webp",
+	"tiff": "tif",
+	"bmp":  "bmp",
+}
+
+// writeImage writes img to the named file in the -format format. There is no
+// WebP encoder in Go, so WebP is encoded by ffmpeg.
+func writeImage(name string, img image.Image) error {
+	if format == "webp" {
+		return writeWebP(name, img)
+	}
+	f, err := createFile(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := encodeImage(w, img); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func encodeImage(w io.Writer, img image.Image) error {
+	switch format {
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case "tiff":
+		return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate})
+	case "bmp":
+		return bmp.Encode(w, img)
+	}
+	return png.Encode(w, img)
+}
+
+// writeWebP encodes img with ffmpeg, streaming it in as PNG rather than
+// encoding it in memory first.
+func writeWebP(name string, img image.Image) error {
+	lossless := "0"
+	if webpLossless {
+		lossless = "1"
+	}
+	cmd := exec.Command("ffmpeg", "-loglevel", "error", "-y", "-f", "png_pipe", "-i", "-",
+		"-c:v", "libwebp", "-lossless", lossless, "-quality", fmt.Sprint(quality), name)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	err = png.Encode(stdin, img)
+	stdin.Close()
+	// If ffmpeg failed, that is why the PNG couldn't be written.
+	if werr := cmd.Wait(); werr != nil {
+		return werr
+	}
+	return err
+}
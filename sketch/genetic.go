@@ -0,0 +1,104 @@
+package sketch
+
+import (
+	"image/color"
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+// With -genetic, each iteration's candidate is the best of a population of
+// that many, evolved for -generations. Each generation, the better half of
+// the population is kept, and the rest replaced by children of pairs of
+// those kept, each taking some of its geometry from one parent, such as
+// where a line starts, and the rest from the other, such as the way it goes
+// from there, and its colour from either, and half of them then mutated as
+// -climb would, moving them a little or taking another colour.
+
+// A member is a candidate in the -genetic population, with its score.
+type member struct {
+	shape    Shape
+	clr      color.RGBA
+	old, neu float64
+}
+
+// fitness is how much the member would lessen the error: the higher the
+// better.
+func (m member) fitness() float64 {
+	return m.old - m.neu
+}
+
+// evolve evolves pop for generations, returning its best member. breed
+// returns a child of a and b, scored.
+func evolve(rng *rand.Rand, pop []member, generations int, breed func(a, b member) member) member {
+	byFitness := func(i, j int) bool { return pop[i].fitness() > pop[j].fitness() }
+	sort.SliceStable(pop, byFitness)
+	kept := max(len(pop)/2, 1)
+	for g := 0; g < generations; g++ {
+		for i := kept; i < len(pop); i++ {
+			pop[i] = breed(pop[rng.Intn(kept)], pop[rng.Intn(kept)])
+		}
+		sort.SliceStable(pop, byFitness)
+	}
+	return pop[0]
+}
+
+// crossShapes returns a shape with some of its geometry from a and the rest
+// from b, which are of the same kind. Points taken from b are moved with
+// those taken from a, so that the child is no larger than its parents.
+func crossShapes(rng *rand.Rand, a, b Shape) Shape {
+	// from picks a's value or b's.
+	from := func(x, y int) int {
+		if rng.Intn(2) == 0 {
+			return x
+		}
+		return y
+	}
+	switch a := a.(type) {
+	case *Line:
+		b := b.(*Line)
+		return &Line{a.X1, a.Y1, a.X1 + b.X2 - b.X1, a.Y1 + b.Y2 - b.Y1, from(a.W, b.W)}
+	case *Curve:
+		b := b.(*Curve)
+		c := *a
+		if rng.Intn(2) == 0 {
+			c.CX, c.CY = a.X1+b.CX-b.X1, a.Y1+b.CY-b.Y1
+		} else {
+			c.X2, c.Y2 = a.X1+b.X2-b.X1, a.Y1+b.Y2-b.Y1
+		}
+		return &c
+	case *Polyline:
+		b := b.(*Polyline)
+		// The child follows a to a point, and then turns as b does from
+		// the same point along it.
+		n := rng.Intn(min(len(a.X), len(b.X)))
+		p := &Polyline{slices.Clone(a.X[:n+1]), slices.Clone(a.Y[:n+1])}
+		for i := n + 1; i < len(b.X); i++ {
+			p.X = append(p.X, a.X[n]+b.X[i]-b.X[n])
+			p.Y = append(p.Y, a.Y[n]+b.Y[i]-b.Y[n])
+		}
+		return p
+	case *Rect:
+		b := b.(*Rect)
+		return &Rect{a.X1, a.Y1, a.X1 + b.X2 - b.X1, a.Y1 + b.Y2 - b.Y1}
+	case *Circle:
+		b := b.(*Circle)
+		return &Circle{a.X, a.Y, b.R}
+	case *Dot:
+		b := b.(*Dot)
+		return &Dot{a.X, a.Y, b.R}
+	case *Ellipse:
+		b := b.(*Ellipse)
+		return &Ellipse{a.X, a.Y, from(a.RX, b.RX), from(a.RY, b.RY)}
+	case *Triangle:
+		b := b.(*Triangle)
+		t := *a
+		if rng.Intn(2) == 0 {
+			t.X2, t.Y2 = a.X1+b.X2-b.X1, a.Y1+b.Y2-b.Y1
+		} else {
+			t.X3, t.Y3 = a.X1+b.X3-b.X1, a.Y1+b.Y3-b.Y1
+		}
+		return &t
+	}
+	panic("unknown shape")
+}
@@ -0,0 +1,155 @@
+package sketch
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"log/slog"
+)
+
+// frameQueue holds the frames of an animated GIF that a source has yet to
+// return, so that every frame of the animation is sketched in turn.
+type frameQueue struct {
+	frames []image.Image
+	delays []int
+	last   int // delay of the frame last returned
+}
+
+// decode reads an image from r. An animated GIF is expanded into its frames,
+// the first of which is returned and the rest queued.
+func (q *frameQueue) decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("GIF8")) {
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if len(g.Image) > 1 {
+			slog.Info("animated GIF", "frames", len(g.Image))
+			q.frames, q.delays = gifFrames(g), g.Delay
+			img, _ := q.pop()
+			return img, nil
+		}
+	}
+	q.last = 0
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+func (q *frameQueue) pop() (image.Image, bool) {
+	if len(q.frames) == 0 {
+		return nil, false
+	}
+	img := q.frames[0]
+	q.frames, q.last = q.frames[1:], q.delays[0]
+	q.delays = q.delays[1:]
+	return img, true
+}
+
+func (q *frameQueue) delay() int {
+	return q.last
+}
+
+// gifFrames renders each frame of an animated GIF as it would be displayed,
+// applying the frame disposal methods.
+func gifFrames(g *gif.GIF) []image.Image {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(bounds)
+	frames := make([]image.Image, len(g.Image))
+	for i, p := range g.Image {
+		var prev *image.RGBA
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			prev = image.NewRGBA(bounds)
+			copy(prev.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, p.Bounds(), p, p.Bounds().Min, draw.Over)
+		frame := image.NewRGBA(bounds)
+		copy(frame.Pix, canvas.Pix)
+		frames[i] = frame
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, p.Bounds(), image.Transparent, image.ZP, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = prev
+		}
+	}
+	return frames
+}
+
+// A delayer is a source that knows how long each frame is shown, in 100ths
+// of a second. delay applies to the frame last returned by next, and is zero
+// when unknown.
+type delayer interface {
+	delay() int
+}
+
+// frameDelay returns how long the frame last read from in should be shown,
+// or zero if in does not know.
+func frameDelay(in source) int {
+	if d, ok := in.(delayer); ok {
+		return d.delay()
+	}
+	return 0
+}
+
+// gifSink assembles frames into an animated GIF, written on close. Each
+// frame is shown for the delay returned by the delay function, or according
+// to -fps if that is nil or returns zero.
+type gifSink struct {
+	name  string
+	delay func() int
+	g     gif.GIF
+}
+
+func (s *gifSink) write(img *image.RGBA) error {
+	s.add(img)
+	saveNum++
+	return nil
+}
+
+// add appends a frame without counting it as a finished output frame.
+func (s *gifSink) add(img *image.RGBA) {
+	p := image.NewPaletted(img.Bounds(), palette.Plan9)
+	draw.FloydSteinberg.Draw(p, p.Bounds(), img, img.Bounds().Min)
+	d := 0
+	if s.delay != nil {
+		d = s.delay()
+	}
+	if d <= 0 {
+		d = int(100/fps + 0.5)
+	}
+	s.g.Image = append(s.g.Image, p)
+	s.g.Delay = append(s.g.Delay, d)
+}
+
+func (s *gifSink) close() error {
+	if len(s.g.Image) == 0 {
+		return nil
+	}
+	f, err := createFile(s.name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := gif.EncodeAll(w, &s.g); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	slog.Info("wrote", "file", s.name)
+	return f.Close()
+}
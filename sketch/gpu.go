@@ -0,0 +1,42 @@
+package sketch
+
+import (
+	"image/color"
+	"math/rand"
+	"sync"
+)
+
+// With -gpu, each iteration draws a batch of -gpu-batch random lines, which
+// the GPU scores in parallel against its own copy of the source and error
+// map. The best of the batch is then checked exactly on the CPU, like any
+// other candidate. The GPU backend needs OpenCL, and is only built with
+// -tags opencl; otherwise sketch falls back to the CPU.
+
+// gpuWarning logs the GPU being unavailable once, rather than per frame.
+var gpuWarning sync.Once
+
+// gpuBatch is a reusable batch of candidates.
+type gpuBatch struct {
+	lines  []Line
+	colors []color.RGBA
+}
+
+func newGPUBatch(n int) *gpuBatch {
+	return &gpuBatch{make([]Line, n), make([]color.RGBA, n)}
+}
+
+// propose fills the batch with random lines, in the colours pick gives them,
+// and returns the one the GPU scores best.
+func (b *gpuBatch) propose(g *gpuScorer, rng *rand.Rand, smp *sampler, pick func(Shape) color.RGBA) (Shape, color.RGBA, error) {
+	for i := range b.lines {
+		l := randomLine(rng, smp)
+		b.lines[i] = *l.(*Line)
+		b.colors[i] = pick(l)
+	}
+	best, err := g.best(b.lines, b.colors)
+	if err != nil {
+		return nil, color.RGBA{}, err
+	}
+	l := b.lines[best]
+	return &l, b.colors[best], nil
+}
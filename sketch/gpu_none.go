@@ -0,0 +1,24 @@
+//go:build !opencl
+
+package sketch
+
+import (
+	"errors"
+	"image/color"
+)
+
+type gpuScorer struct{}
+
+func newGPUScorer(src *plane, errs *errMap, batch int) (*gpuScorer, error) {
+	return nil, errors.New("built without OpenCL, rebuild with -tags opencl")
+}
+
+func (g *gpuScorer) best(lines []Line, colors []color.RGBA) (int, error) {
+	panic("unreachable")
+}
+
+func (g *gpuScorer) update(l *Line, errs *errMap) error {
+	panic("unreachable")
+}
+
+func (g *gpuScorer) close() {}
@@ -0,0 +1,298 @@
+//go:build opencl
+
+package sketch
+
+/*
+#cgo CFLAGS: -DCL_TARGET_OPENCL_VERSION=120
+#cgo linux LDFLAGS: -lOpenCL
+#cgo darwin LDFLAGS: -framework OpenCL
+#include <stdlib.h>
+#ifdef __APPLE__
+#include <OpenCL/opencl.h>
+#else
+#include <CL/cl.h>
+#endif
+*/
+import "C"
+
+import (
+	"fmt"
+	"image/color"
+	"unsafe"
+)
+
+// scoreKernel sums, for each candidate line, the change in distance from
+// the source that drawing it would make. It walks the same pixels as bline.
+const scoreKernel = `
+#define PLOT(px, py) sum += delta(src, err, w, h, px, py, c)
+
+float delta(__global const float *src, __global const float *err,
+		int w, int h, int x, int y, float4 c) {
+	if (x < 0 || y < 0 || x >= w || y >= h)
+		return 0;
+	int i = y*w + x;
+	float4 d = vload4(i, src) - c;
+	return sqrt(dot(d, d)) - err[i];
+}
+
+__kernel void score(__global const float *src, __global const float *err,
+		int w, int h, __global const int4 *lines, __global const uint *colors,
+		__global float *out) {
+	int id = get_global_id(0);
+	int4 l = lines[id];
+	uint u = colors[id];
+	float4 c = (float4)(u & 255, (u >> 8) & 255, (u >> 16) & 255, u >> 24) * 257.0f;
+	int x1 = l.x, y1 = l.y, x2 = l.z, y2 = l.w, t;
+	float sum = 0;
+
+	if (x1 > x2) {
+		t = x1; x1 = x2; x2 = t;
+		t = y1; y1 = y2; y2 = t;
+	}
+	int dx = x2 - x1, dy = abs(y2 - y1), e, slope;
+
+	if (x1 == x2 && y1 == y2) {
+		PLOT(x1, y1);
+	} else if (y1 == y2) {
+		for (; dx != 0; dx--, x1++)
+			PLOT(x1, y1);
+		PLOT(x1, y1);
+	} else if (x1 == x2) {
+		if (y1 > y2) {
+			t = y1; y1 = y2; y2 = t;
+		}
+		for (; dy != 0; dy--, y1++)
+			PLOT(x1, y1);
+		PLOT(x1, y1);
+	} else if (dx == dy) {
+		int sy = y1 < y2 ? 1 : -1;
+		for (; dx != 0; dx--, x1++, y1 += sy)
+			PLOT(x1, y1);
+		PLOT(x1, y1);
+	} else if (dx > dy) {
+		int sy = y1 < y2 ? 1 : -1;
+		dy *= 2; e = dx; slope = 2*dx;
+		for (; dx != 0; dx--) {
+			PLOT(x1, y1);
+			x1++;
+			e -= dy;
+			if (e < 0) {
+				y1 += sy;
+				e += slope;
+			}
+		}
+		PLOT(x2, y2);
+	} else {
+		int sy = y1 < y2 ? 1 : -1;
+		dx *= 2; e = dy; slope = 2*dy;
+		for (; dy != 0; dy--) {
+			PLOT(x1, y1);
+			y1 += sy;
+			e -= dx;
+			if (e < 0) {
+				x1++;
+				e += slope;
+			}
+		}
+		PLOT(x2, y2);
+	}
+	out[id] = sum;
+}
+`
+
+// gpuScorer holds the OpenCL state for scoring lines. The error map is kept
+// on the device as float32s, and rows are uploaded again as strokes are
+// accepted.
+type gpuScorer struct {
+	ctx    C.cl_context
+	queue  C.cl_command_queue
+	prog   C.cl_program
+	kernel C.cl_kernel
+	src    C.cl_mem
+	err    C.cl_mem
+	lines  C.cl_mem
+	colors C.cl_mem
+	out    C.cl_mem
+	w, h   int
+	n      int
+	row    []float32   // staging for error map uploads
+	linev  []C.cl_int  // 4 per line
+	colorv []C.cl_uint // packed RGBA
+	outv   []float32
+}
+
+func clError(code C.cl_int, what string) error {
+	return fmt.Errorf("opencl: %s failed with error %d", what, int(code))
+}
+
+func newGPUScorer(src *plane, errs *errMap, batch int) (*gpuScorer, error) {
+	g := &gpuScorer{w: errs.w, h: errs.h, n: batch}
+	var code C.cl_int
+
+	var platform C.cl_platform_id
+	var nplat C.cl_uint
+	if code = C.clGetPlatformIDs(1, &platform, &nplat); code != C.CL_SUCCESS || nplat == 0 {
+		return nil, fmt.Errorf("opencl: no platform available")
+	}
+	var device C.cl_device_id
+	if code = C.clGetDeviceIDs(platform, C.CL_DEVICE_TYPE_GPU, 1, &device, nil); code != C.CL_SUCCESS {
+		return nil, fmt.Errorf("opencl: no GPU device available")
+	}
+	g.ctx = C.clCreateContext(nil, 1, &device, nil, nil, &code)
+	if code != C.CL_SUCCESS {
+		return nil, clError(code, "clCreateContext")
+	}
+	g.queue = C.clCreateCommandQueue(g.ctx, device, 0, &code)
+	if code != C.CL_SUCCESS {
+		g.close()
+		return nil, clError(code, "clCreateCommandQueue")
+	}
+
+	csrc := C.CString(scoreKernel)
+	defer C.free(unsafe.Pointer(csrc))
+	g.prog = C.clCreateProgramWithSource(g.ctx, 1, &csrc, nil, &code)
+	if code != C.CL_SUCCESS {
+		g.close()
+		return nil, clError(code, "clCreateProgramWithSource")
+	}
+	if code = C.clBuildProgram(g.prog, 1, &device, nil, nil, nil); code != C.CL_SUCCESS {
+		g.close()
+		return nil, clError(code, "clBuildProgram")
+	}
+	name := C.CString("score")
+	defer C.free(unsafe.Pointer(name))
+	g.kernel = C.clCreateKernel(g.prog, name, &code)
+	if code != C.CL_SUCCESS {
+		g.close()
+		return nil, clError(code, "clCreateKernel")
+	}
+
+	npix := g.w * g.h
+	g.src = C.clCreateBuffer(g.ctx, C.CL_MEM_READ_ONLY|C.CL_MEM_COPY_HOST_PTR,
+		C.size_t(4*npix*4), unsafe.Pointer(&src.Pix[0]), &code)
+	if code != C.CL_SUCCESS {
+		g.close()
+		return nil, clError(code, "clCreateBuffer")
+	}
+	g.row = make([]float32, npix)
+	for i, d := range errs.dist {
+		g.row[i] = float32(d)
+	}
+	g.err = C.clCreateBuffer(g.ctx, C.CL_MEM_READ_ONLY|C.CL_MEM_COPY_HOST_PTR,
+		C.size_t(npix*4), unsafe.Pointer(&g.row[0]), &code)
+	if code != C.CL_SUCCESS {
+		g.close()
+		return nil, clError(code, "clCreateBuffer")
+	}
+	for _, b := range []struct {
+		mem   *C.cl_mem
+		size  int
+		flags C.cl_mem_flags
+	}{
+		{&g.lines, batch * 16, C.CL_MEM_READ_ONLY},
+		{&g.colors, batch * 4, C.CL_MEM_READ_ONLY},
+		{&g.out, batch * 4, C.CL_MEM_WRITE_ONLY},
+	} {
+		*b.mem = C.clCreateBuffer(g.ctx, b.flags, C.size_t(b.size), nil, &code)
+		if code != C.CL_SUCCESS {
+			g.close()
+			return nil, clError(code, "clCreateBuffer")
+		}
+	}
+
+	w, h := C.cl_int(g.w), C.cl_int(g.h)
+	args := []struct {
+		size C.size_t
+		ptr  unsafe.Pointer
+	}{
+		{C.size_t(unsafe.Sizeof(g.src)), unsafe.Pointer(&g.src)},
+		{C.size_t(unsafe.Sizeof(g.err)), unsafe.Pointer(&g.err)},
+		{C.size_t(unsafe.Sizeof(w)), unsafe.Pointer(&w)},
+		{C.size_t(unsafe.Sizeof(h)), unsafe.Pointer(&h)},
+		{C.size_t(unsafe.Sizeof(g.lines)), unsafe.Pointer(&g.lines)},
+		{C.size_t(unsafe.Sizeof(g.colors)), unsafe.Pointer(&g.colors)},
+		{C.size_t(unsafe.Sizeof(g.out)), unsafe.Pointer(&g.out)},
+	}
+	for i, a := range args {
+		if code = C.clSetKernelArg(g.kernel, C.cl_uint(i), a.size, a.ptr); code != C.CL_SUCCESS {
+			g.close()
+			return nil, clError(code, "clSetKernelArg")
+		}
+	}
+
+	g.linev = make([]C.cl_int, 4*batch)
+	g.colorv = make([]C.cl_uint, batch)
+	g.outv = make([]float32, batch)
+	return g, nil
+}
+
+// best returns the index of the line that lowers the error the most, as far
+// as float32 arithmetic can tell.
+func (g *gpuScorer) best(lines []Line, colors []color.RGBA) (int, error) {
+	for i, l := range lines {
+		g.linev[4*i], g.linev[4*i+1] = C.cl_int(l.X1), C.cl_int(l.Y1)
+		g.linev[4*i+2], g.linev[4*i+3] = C.cl_int(l.X2), C.cl_int(l.Y2)
+		c := colors[i]
+		g.colorv[i] = C.cl_uint(c.R) | C.cl_uint(c.G)<<8 | C.cl_uint(c.B)<<16 | C.cl_uint(c.A)<<24
+	}
+	if code := C.clEnqueueWriteBuffer(g.queue, g.lines, C.CL_FALSE, 0,
+		C.size_t(16*g.n), unsafe.Pointer(&g.linev[0]), 0, nil, nil); code != C.CL_SUCCESS {
+		return 0, clError(code, "clEnqueueWriteBuffer")
+	}
+	if code := C.clEnqueueWriteBuffer(g.queue, g.colors, C.CL_FALSE, 0,
+		C.size_t(4*g.n), unsafe.Pointer(&g.colorv[0]), 0, nil, nil); code != C.CL_SUCCESS {
+		return 0, clError(code, "clEnqueueWriteBuffer")
+	}
+	global := C.size_t(g.n)
+	if code := C.clEnqueueNDRangeKernel(g.queue, g.kernel, 1, nil, &global, nil, 0, nil, nil); code != C.CL_SUCCESS {
+		return 0, clError(code, "clEnqueueNDRangeKernel")
+	}
+	if code := C.clEnqueueReadBuffer(g.queue, g.out, C.CL_TRUE, 0,
+		C.size_t(4*g.n), unsafe.Pointer(&g.outv[0]), 0, nil, nil); code != C.CL_SUCCESS {
+		return 0, clError(code, "clEnqueueReadBuffer")
+	}
+	best := 0
+	for i, v := range g.outv {
+		if v < g.outv[best] {
+			best = i
+		}
+	}
+	return best, nil
+}
+
+// update uploads the error map rows that l covers, once it has been drawn.
+func (g *gpuScorer) update(l *Line, errs *errMap) error {
+	y0, y1 := imax(imin(l.Y1, l.Y2), 0), imin(imax(l.Y1, l.Y2), g.h-1)
+	if y0 > y1 {
+		return nil
+	}
+	row := g.row[y0*g.w : (y1+1)*g.w]
+	for i := range row {
+		row[i] = float32(errs.dist[y0*g.w+i])
+	}
+	if code := C.clEnqueueWriteBuffer(g.queue, g.err, C.CL_TRUE, C.size_t(4*y0*g.w),
+		C.size_t(4*len(row)), unsafe.Pointer(&row[0]), 0, nil, nil); code != C.CL_SUCCESS {
+		return clError(code, "clEnqueueWriteBuffer")
+	}
+	return nil
+}
+
+func (g *gpuScorer) close() {
+	for _, m := range []C.cl_mem{g.src, g.err, g.lines, g.colors, g.out} {
+		if m != nil {
+			C.clReleaseMemObject(m)
+		}
+	}
+	if g.kernel != nil {
+		C.clReleaseKernel(g.kernel)
+	}
+	if g.prog != nil {
+		C.clReleaseProgram(g.prog)
+	}
+	if g.queue != nil {
+		C.clReleaseCommandQueue(g.queue)
+	}
+	if g.ctx != nil {
+		C.clReleaseContext(g.ctx)
+	}
+}
@@ -0,0 +1,109 @@
+//go:build grpc
+
+package sketch
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"log"
+	"log/slog"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer implements the Sketch service of sketch.proto, on the jobs of
+// a server.
+type grpcServer struct {
+	UnimplementedSketchServer
+	s *server
+}
+
+// listenGRPC starts serving the Sketch service on addr, for s's jobs.
+func listenGRPC(addr string, s *server) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	g := grpc.NewServer()
+	RegisterSketchServer(g, &grpcServer{s: s})
+	slog.Info("serving gRPC", "addr", ln.Addr())
+	go func() {
+		log.Fatalln(g.Serve(ln))
+	}()
+	return nil
+}
+
+func (g *grpcServer) SubmitJob(_ context.Context, req *SubmitJobRequest) (*JobRef, error) {
+	if req.Iters < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "bad iters %d", req.Iters)
+	}
+	img, _, err := image.Decode(bytes.NewReader(req.Image))
+	if err == nil {
+		img, _, err = cropSource(img)
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	sj := g.s.submit(img, int(req.Iters))
+	return &JobRef{Id: int32(sj.id)}, nil
+}
+
+func (g *grpcServer) StreamProgress(req *ProgressRequest, stream grpc.ServerStreamingServer[Progress]) error {
+	sj := g.s.lookup(int(req.Id))
+	if sj == nil {
+		return status.Error(codes.NotFound, "no such job")
+	}
+	for {
+		sj.mu.Lock()
+		p := &Progress{State: sj.state}
+		if r := sj.stats; r != nil {
+			p.Iter, p.IterPerS = int32(r.Iter), r.IterRate
+			p.Accepted, p.AcceptedPerS = int32(r.Accepted), r.AcceptRate
+			p.RmsError, p.ElapsedS = r.RMSError, r.Elapsed
+		}
+		var err error
+		if req.Canvas && sj.canvas != nil {
+			var buf bytes.Buffer
+			err = encodeImage(&buf, sj.canvas)
+			p.Canvas = buf.Bytes()
+		}
+		changed := sj.changed
+		sj.mu.Unlock()
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.Send(p); err != nil {
+			return err
+		}
+		if p.State == "done" {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func (g *grpcServer) GetResult(_ context.Context, req *JobRef) (*Result, error) {
+	sj := g.s.lookup(int(req.Id))
+	if sj == nil {
+		return nil, status.Error(codes.NotFound, "no such job")
+	}
+	sj.mu.Lock()
+	done := sj.state == "done"
+	sj.mu.Unlock()
+	if !done {
+		return nil, status.Error(codes.FailedPrecondition, "job not done")
+	}
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, sj.j.img); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &Result{Image: buf.Bytes(), ContentType: serveTypes[format]}, nil
+}
@@ -0,0 +1,9 @@
+//go:build !grpc
+
+package sketch
+
+import "errors"
+
+func listenGRPC(addr string, s *server) error {
+	return errors.New("built without gRPC, rebuild with -tags grpc")
+}
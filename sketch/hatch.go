@@ -0,0 +1,47 @@
+package sketch
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// With -hatch, the source is first turned into a hatched drawing of itself,
+// which is then sketched in place of the source, in -ink only and with lines
+// at the hatching angles. Each of the -hatch passes lays parallel lines,
+// -hatch-spacing pixels apart, over the parts of the source needing more ink
+// than that pass's threshold, at an angle of its own, so that the more ink a
+// part needs, the more layers of hatching it gets.
+
+// hatchAngles are the angles of successive passes, in degrees, alternating
+// between the diagonals and then the axes.
+var hatchAngles = []float64{45, 135, 0, 90, 22.5, 112.5, 67.5, 157.5}
+
+// hatch returns the hatched drawing of img, on the background bg.
+func hatch(img *image.RGBA, bg color.RGBA) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	out := blankCanvas(img.Rect, bg)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dark := inkAmount(img.RGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y), bg)
+			for k := 0; k < hatchPasses; k++ {
+				if dark <= float64(k+1)/float64(hatchPasses+1) {
+					break
+				}
+				if onHatch(hatchAngles[k]*math.Pi/180, x, y) {
+					out.SetRGBA(x, y, ink)
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+// onHatch reports whether (x, y) is on one of the lines of a hatching at
+// angle a, anticlockwise from horizontal.
+func onHatch(a float64, x, y int) bool {
+	// Distance across the lines, with y running down.
+	d := float64(x)*math.Sin(a) + float64(y)*math.Cos(a)
+	return int(math.Floor(d))%hatchSpacing == 0
+}
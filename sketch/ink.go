@@ -0,0 +1,53 @@
+package sketch
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// With -ink, strokes are all drawn in the one colour, so that tone comes
+// only from how densely they cover the background. The source is first
+// turned into the tones of that ink on the background, which is then
+// sketched in place of the source.
+
+// ink is the colour drawn in with -ink or -hatch.
+var ink = color.RGBA{0, 0, 0, 255}
+
+// parseInk parses the -ink flag, which is black, white or #rrggbb.
+func parseInk(s string) (color.RGBA, error) {
+	c, avg, err := parseBackground(s)
+	if err != nil || avg || c.A != 255 {
+		return color.RGBA{}, fmt.Errorf("invalid ink %q", s)
+	}
+	return c, nil
+}
+
+// luma returns the brightness of c, from 0 to 0xff.
+func luma(c color.RGBA) float64 {
+	return float64(color.GrayModel.Convert(c).(color.Gray).Y)
+}
+
+// inkAmount returns how much ink it takes for the background bg to look as
+// bright as c, from 0 for none to 1 for solid ink.
+func inkAmount(c, bg color.RGBA) float64 {
+	lb, li := luma(bg), luma(ink)
+	if lb == li {
+		return 0
+	}
+	return math.Max(0, math.Min(1, (lb-luma(c))/(lb-li)))
+}
+
+// inkTones returns img in the tones of ink on the background bg.
+func inkTones(img *image.RGBA, bg color.RGBA) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := inkAmount(img.RGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y), bg)
+			out.SetRGBA(x, y, blend([]uint8{bg.R, bg.G, bg.B, bg.A}, ink, a))
+		}
+	}
+	return out
+}
@@ -0,0 +1,163 @@
+package sketch
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"log"
+	"log/slog"
+	"math/rand"
+)
+
+// A job is a frame being sketched, possibly alongside others with -jobs.
+// Each job has its own random number generator, seeded from -seed and the
+// frame's index, so that a frame comes out the same however many are
+// sketched at once.
+type job struct {
+	n       int   // frame index
+	seed    int64 // of rng
+	src     image.Image
+	scale   float64         // by which src was scaled down with -max-dim, if not 1
+	full    image.Image     // the source src was cropped from, with -crop-composite
+	crop    image.Rectangle // where in full src was cropped from
+	delay   int             // of the source frame, for -gif
+	rng     *rand.Rand
+	draws   *countingSource // rng's source
+	resume  *checkpoint     // if resuming the frame
+	bg      color.RGBA      // of the blank canvas
+	iters   int             // in place of -iter, with -adaptive
+	budget  budget          // after this frame's iterations, with -adaptive
+	logger  *slog.Logger
+	buf     bytes.Buffer // log output, if buffered
+	img     *image.RGBA
+	strokes []stroke
+	rms     float64       // RMS error of img, as for -target
+	others  []*image.RGBA // by restart, those not kept, with -restarts-out
+	done    chan struct{}
+
+	// progress, if set, is called every -stat interval with the statistics
+	// and the canvas, which it mustn't keep.
+	progress func(statReport, *image.RGBA)
+
+	// steps, if set, grants iterations to sketch, which wait for each grant
+	// once the last is used up, and then send the canvas on stepped.
+	steps   chan int
+	stepped chan *image.RGBA
+
+	// With -warm, the previous frame, and the strokes leading up to it for
+	// -svg.
+	warm        *image.RGBA
+	warmStrokes []stroke
+}
+
+// newJob returns a job for src, frame n of a run seeded with seed. If
+// buffered is set, its log output is held back until wait, so that the
+// output of concurrent jobs isn't interleaved.
+func newJob(n int, src image.Image, delay int, seed int64, buffered bool) *job {
+	j := &job{n: n, seed: seed + int64(n), src: src, scale: 1, delay: delay, bg: frameBackground(src), done: make(chan struct{})}
+	j.draws = newCountingSource(j.seed)
+	j.rng = rand.New(j.draws)
+	j.logger = slog.Default()
+	if buffered {
+		j.logger = slog.New(newLogHandler(&j.buf))
+	}
+	j.logger = j.logger.With("frame", n)
+	if preview != nil {
+		j.progress = preview.push
+	}
+	return j
+}
+
+func (j *job) run() {
+	if numRestarts > 1 && j.steps == nil {
+		j.img, j.strokes = sketchRestarts(j)
+	} else {
+		j.img, j.strokes = j.sketch()
+	}
+	j.src = nil
+	close(j.done)
+}
+
+// sketch sketches j, tile by tile with -tiles or if it doesn't fit whole in
+// -max-memory.
+func (j *job) sketch() (*image.RGBA, []stroke) {
+	if tileSize > 0 && j.steps == nil {
+		return sketchTiles(j, tileSize)
+	}
+	if memoryBudget > 0 && j.steps == nil {
+		r := j.src.Bounds()
+		size, err := fitTiles(r.Dx(), r.Dy())
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if size > 0 {
+			if checkpointFile != "" || resumeFile != "" || timelapseFile != "" {
+				log.Fatalf("a frame of %dx%d needs -tiles to fit in -max-memory, which can't be used with -checkpoint, -resume or -timelapse\n", r.Dx(), r.Dy())
+			}
+			j.logger.Info("sketching in tiles to fit in memory", "size", size)
+			return sketchTiles(j, size)
+		}
+	}
+	return j.sketchOne()
+}
+
+// sketchOne sketches j in one piece, coarse to fine with -pyramid.
+func (j *job) sketchOne() (*image.RGBA, []stroke) {
+	if pyramidLevels > 1 && j.steps == nil {
+		return sketchPyramid(j)
+	}
+	return sketch(j)
+}
+
+// warmState returns the canvas and strokes that the frame after j starts
+// from with -warm, once j is done.
+func (j *job) warmState() (*image.RGBA, []stroke) {
+	if !warmStart {
+		return nil, nil
+	}
+	var strokes []stroke
+	if svgFile != "" {
+		strokes = j.allStrokes()
+	}
+	return j.img, strokes
+}
+
+// allStrokes returns j's strokes, after those of the frames it started from.
+func (j *job) allStrokes() []stroke {
+	return append(j.warmStrokes[:len(j.warmStrokes):len(j.warmStrokes)], j.strokes...)
+}
+
+// wait waits for the job to finish, and then prints its log output.
+func (j *job) wait() {
+	<-j.done
+	logOutput.Write(j.buf.Bytes())
+}
+
+// startSteps has j only sketch the iterations granted by step. It must be
+// called before run.
+func (j *job) startSteps() {
+	j.steps, j.stepped = make(chan int), make(chan *image.RGBA)
+}
+
+// step has j sketch n more iterations, n > 0, and returns the canvas after
+// them, which mustn't be used once j is stepped again, and whether j can be
+// stepped further. Once it can't, the canvas is the finished sketch.
+func (j *job) step(n int) (*image.RGBA, bool) {
+	select {
+	case j.steps <- n:
+	case <-j.done:
+		return j.img, false
+	}
+	select {
+	case canvas := <-j.stepped:
+		return canvas, true
+	case <-j.done:
+		return j.img, false
+	}
+}
+
+// stop finishes a job started with startSteps, and waits for it.
+func (j *job) stop() {
+	close(j.steps)
+	<-j.done
+}
@@ -0,0 +1,82 @@
+package sketch
+
+import (
+	"image/color"
+	"math"
+)
+
+// With -metric lab, the source and canvas are compared in CIELAB, and the
+// distance between two pixels is their delta E (CIE76), which follows
+// perceived differences in colour more closely than distance in RGB does.
+// With -metric linear, they are compared in linear light, as distance in
+// RGB once the sRGB gamma curve is undone. Colours are taken as they are
+// stored, premultiplied, which for the opaque canvas is as they look.
+
+// labScale scales CIELAB to the 16 bit scale of color.Color, so that a
+// delta E of 100, from black to white, is as far as from 0 to 0xffff in one
+// channel of RGB.
+const labScale = 0xffff / 100.0
+
+// linear maps 8 bit sRGB samples to linear light, from 0 to 1.
+var linear [256]float64
+
+func init() {
+	for i := range linear {
+		v := float64(i) / 0xff
+		if v <= 0.04045 {
+			linear[i] = v / 12.92
+		} else {
+			linear[i] = math.Pow((v+0.055)/1.055, 2.4)
+		}
+	}
+}
+
+// linearSamples returns c in linear light, on the 16 bit scale, with its
+// alpha as it is.
+func linearSamples(c color.RGBA) [4]float64 {
+	return [4]float64{0xffff * linear[c.R], 0xffff * linear[c.G], 0xffff * linear[c.B], sample16[c.A]}
+}
+
+// labSamples returns c in CIELAB, under the D65 white point, on labScale,
+// with its alpha on the 16 bit scale.
+func labSamples(c color.RGBA) [4]float64 {
+	r, g, b := linear[c.R], linear[c.G], linear[c.B]
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / 0.95047
+	y := 0.2126729*r + 0.7151522*g + 0.0721750*b
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / 1.08883
+	fx, fy, fz := labf(x), labf(y), labf(z)
+	return [4]float64{
+		labScale * (116*fy - 16),
+		labScale * 500 * (fx - fy),
+		labScale * 200 * (fy - fz),
+		sample16[c.A],
+	}
+}
+
+// labRoots tabulates the cube root over [0, 1], the range of X, Y and Z
+// relative to the white point, for labf to interpolate between, as every
+// blended pixel of every candidate is converted, and math.Cbrt is slow. It
+// is within 1e-5 of math.Cbrt.
+var labRoots [labSteps + 2]float64
+
+const labSteps = 1 << 12
+
+func init() {
+	for i := range labRoots {
+		labRoots[i] = math.Cbrt(float64(i) / labSteps)
+	}
+}
+
+func labf(t float64) float64 {
+	const d = 6.0 / 29
+	if t <= d*d*d {
+		return t/(3*d*d) + 4.0/29
+	}
+	v := t * labSteps
+	i := int(v)
+	if i > labSteps {
+		// Only by rounding, just past the white point.
+		return math.Cbrt(t)
+	}
+	return labRoots[i] + (v-float64(i))*(labRoots[i+1]-labRoots[i])
+}
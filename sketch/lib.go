@@ -0,0 +1,109 @@
+package sketch
+
+import (
+	"errors"
+	"flag"
+	"image"
+	"slices"
+	"sync"
+)
+
+// Used as a library, sketch sketches images in memory, without reading or
+// writing files unless flags such as -save or -svg ask it to: SetFlag sets
+// flags as they would be on the command line, for the sketches started
+// after it, and Sketch sketches an image. Flags sketch would refuse to run
+// with are errors rather than ending the program. The C interface of -tags
+// cshared and the mobile package are built on them.
+
+// libMu guards libSetup, and the handles of the C interface.
+var libMu sync.Mutex
+var libSetup bool // whether setupSketch has run since the flags were last set
+
+// libRun is held by the sketch in progress, as sketches share the flags
+// and Stop.
+var libRun sync.Mutex
+
+// SetFlag sets the flag name to value. The flag is set even if the flags
+// are then out of bounds or don't go together, which SetFlag returns, and
+// so will Sketch until they're set right.
+func SetFlag(name, value string) error {
+	libMu.Lock()
+	defer libMu.Unlock()
+	if err := flag.Set(name, value); err != nil {
+		return err
+	}
+	libSetup = false
+	setupLogging()
+	return validateFlags()
+}
+
+// newLibJob returns a job for img, with the flags as they are set.
+func newLibJob(img image.Image) (*job, error) {
+	seed, err := parseSeed(seedFlag)
+	if err != nil {
+		return nil, err
+	}
+	libMu.Lock()
+	defer libMu.Unlock()
+	if !libSetup {
+		if err := setupSketch(); err != nil {
+			return nil, err
+		}
+		libSetup = true
+	}
+	if err := checkFrame(img); err != nil {
+		return nil, err
+	}
+	return newJob(0, img, 0, seed, false), nil
+}
+
+// checkFrame returns why img can't be sketched with the flags as they are,
+// for what sketch would otherwise end the program over partway through.
+func checkFrame(img image.Image) error {
+	r := img.Bounds()
+	w, h := r.Dx(), r.Dy()
+	if weightImage != nil {
+		wm := newWeightMap(weightImage, w, h)
+		if !slices.ContainsFunc(wm.weight, func(wt float64) bool { return wt > 0 }) {
+			return errors.New("the weight map is all black")
+		}
+	}
+	if maskImage != nil && paletteImage == nil && colorMode == "palette" {
+		m := newMask(maskImage, w, h)
+		if !slices.Contains(m.blocked, false) {
+			return errors.New("the mask leaves nothing to sketch")
+		}
+	}
+	if memoryBudget > 0 && tileSize == 0 {
+		if _, err := fitTiles(w, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sketch sketches img, for iters iterations or as -iter says if 0, and
+// returns the sketch. progress, if not nil, is called every -stat interval
+// with the iterations done and the canvas, which it mustn't keep. Sketches
+// run one at a time, in turn.
+func Sketch(img image.Image, iters int, progress func(iters int, canvas *image.RGBA)) (*image.RGBA, error) {
+	j, err := newLibJob(img)
+	if err != nil {
+		return nil, err
+	}
+	j.iters = iters
+	if progress != nil {
+		j.progress = func(r statReport, canvas *image.RGBA) { progress(r.Iter, canvas) }
+	}
+	libRun.Lock()
+	defer libRun.Unlock()
+	interrupted.Store(false)
+	j.run()
+	return j.img, nil
+}
+
+// Stop stops the sketch in progress, which returns the sketch as it is.
+// Sketches waiting their turn aren't stopped.
+func Stop() {
+	interrupted.Store(true)
+}
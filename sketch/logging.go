@@ -0,0 +1,92 @@
+package sketch
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Progress is logged through log/slog, at the level set by -v or -q, as
+// plain lines of text or, with -log-format json, as lines of JSON. Fatal
+// errors are still logged through the log package, which slog's default
+// logger takes over at the error level, so that -q never hides them.
+
+// logOutput is where logs are written.
+var logOutput io.Writer = os.Stderr
+
+// setupLogging sets slog's default logger from the logging flags.
+func setupLogging() {
+	slog.SetDefault(slog.New(newLogHandler(logOutput)))
+	slog.SetLogLoggerLevel(slog.LevelError)
+}
+
+// newLogHandler returns a handler for the logging flags, writing to w.
+func newLogHandler(w io.Writer) slog.Handler {
+	level := slog.LevelInfo
+	switch {
+	case verbose:
+		level = slog.LevelDebug
+	case quietLogs:
+		level = slog.LevelWarn
+	}
+	if logFormat == "json" {
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	}
+	return &lineHandler{mu: new(sync.Mutex), w: w, level: level}
+}
+
+// A lineHandler writes each record as its message followed by its
+// attributes as key=value, without a time or level, like the log package
+// does with no flags.
+type lineHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Level
+	attrs []byte // formatted attributes from WithAttrs
+}
+
+func (h *lineHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *lineHandler) Handle(_ context.Context, r slog.Record) error {
+	b := append([]byte(r.Message), h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		b = appendAttr(b, a)
+		return true
+	})
+	b = append(b, '\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(b)
+	return err
+}
+
+func (h *lineHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = h.attrs[:len(h.attrs):len(h.attrs)]
+	for _, a := range attrs {
+		h2.attrs = appendAttr(h2.attrs, a)
+	}
+	return &h2
+}
+
+// WithGroup returns h, as sketch doesn't group attributes.
+func (h *lineHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func appendAttr(b []byte, a slog.Attr) []byte {
+	if a.Equal(slog.Attr{}) {
+		return b
+	}
+	v := a.Value.Resolve().String()
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		v = strconv.Quote(v)
+	}
+	return append(append(append(append(b, ' '), a.Key...), '='), v...)
+}
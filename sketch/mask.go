@@ -0,0 +1,43 @@
+package sketch
+
+import (
+	xdraw "golang.org/x/image/draw"
+	"image"
+	"image/draw"
+)
+
+// A mask marks the pixels of a frame that strokes may not touch, from the
+// dark pixels of the -mask image scaled to the frame's size.
+type mask struct {
+	blocked []bool
+	w, h    int
+}
+
+func newMask(img image.Image, w, h int) *mask {
+	m := &mask{blocked: make([]bool, w*h), w: w, h: h}
+	for i, y := range scaledGray(img, w, h).Pix {
+		m.blocked[i] = y < 0x80
+	}
+	return m
+}
+
+// scaledGray returns img in shades of grey, scaled to w by h.
+func scaledGray(img image.Image, w, h int) *image.Gray {
+	gray := image.NewGray(image.Rect(0, 0, w, h))
+	r := img.Bounds()
+	if r.Size() == gray.Rect.Size() {
+		draw.Draw(gray, gray.Rect, img, r.Min, draw.Src)
+	} else {
+		xdraw.ApproxBiLinear.Scale(gray, gray.Rect, img, r, draw.Src, nil)
+	}
+	return gray
+}
+
+// at reports whether (x, y) is masked off, which it never is outside the
+// canvas.
+func (m *mask) at(x, y int) bool {
+	if uint(x) >= uint(m.w) || uint(y) >= uint(m.h) {
+		return false
+	}
+	return m.blocked[y*m.w+x]
+}
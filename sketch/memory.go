@@ -0,0 +1,114 @@
+package sketch
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// With -max-memory, sketch keeps within a budget of that many bytes: the
+// garbage collector is told to work harder as the heap nears it, and a frame
+// too large to sketch whole within a frame's share of it, the budget split
+// between -jobs and -restart-jobs, is sketched in -tiles as large as fit,
+// -tile-jobs of them at once. Only the source and the canvases are then held
+// at full size. What a frame takes is reckoned from the buffers sketching
+// it allocates, so the budget is kept to within what the runtime and the
+// strokes kept for -svg take besides. The budget can be given in bytes, or
+// with a suffix of K, M or G for 2^10, 2^20 or 2^30 of them.
+
+// pixelBytes returns about how many bytes sketch takes per pixel of its
+// canvas: the source as scored, its colours as floats, the canvas and the
+// error at each pixel, and the buffers the flags add to them. -metric ssim
+// only adds tables as large as the windows around a candidate.
+func pixelBytes() int64 {
+	n := int64(4 + 16 + 4 + 8)
+	if weightImage != nil {
+		n += 8 // the weights
+	}
+	if weightImage != nil || edgeBias > 0 {
+		n += 16 // the placement weights, and their running sums to sample by
+	}
+	if edgeBias > 0 {
+		n += 8 // the edge magnitudes
+	}
+	if maskImage != nil {
+		n += 2 // the mask, and the grey image it was scaled to
+	}
+	if residualEvery > 0 {
+		n += 24 // the residual, and its alias table
+	}
+	if focusBias > 0 {
+		n += 1 // the quadtree's sums, a cell for every 64 pixels
+		if maskImage != nil || weightImage != nil {
+			n += 8 // the weights the error is scaled by
+		}
+	}
+	if flowStrength > 0 {
+		n += 40 // the structure tensor, and the field made from it
+	}
+	if hatchPasses > 0 || inkFlag != "" || duotoneFlag != "" {
+		n += 4 // the source in tones of the ink
+	}
+	if compareOutput {
+		n += 16 // the heat map, and the comparison it is put into
+	} else if errmapOutput {
+		n += 4 // the heat map
+	}
+	return n
+}
+
+// frameBytes is about how many bytes per pixel a tiled frame takes outside
+// its tiles: the source, the canvas it was warmed from, the tiles' canvases
+// until they are stitched and the stitched canvas.
+const frameBytes = 16
+
+var memoryBudget int64
+
+// gcLimit is the garbage collector's memory limit before -max-memory, such
+// as from GOMEMLIMIT, for a library whose flags are set again without it.
+var gcLimit = debug.SetMemoryLimit(-1)
+
+// parseBytes parses the -max-memory flag.
+func parseBytes(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	digits, k := s, int64(1)
+	for suffix, v := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if d, ok := strings.CutSuffix(s, suffix); ok {
+			digits, k = d, v
+		}
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 1 || n > math.MaxInt64/k {
+		return 0, fmt.Errorf("invalid memory budget %q", s)
+	}
+	return n * k, nil
+}
+
+// memoryShare returns the bytes of -max-memory each frame can use.
+func memoryShare() int64 {
+	share := memoryBudget / int64(numJobs)
+	if numRestarts > 1 {
+		share /= int64(restartJobs)
+	}
+	return share
+}
+
+// fitTiles returns the size of the largest tiles a frame of w by h pixels
+// can be sketched in within its share of -max-memory, or 0 if it fits whole.
+func fitTiles(w, h int) (int, error) {
+	share, area := memoryShare(), int64(w)*int64(h)
+	perPixel := pixelBytes()
+	if area*perPixel <= share {
+		return 0, nil
+	}
+	left := share - area*frameBytes
+	size := int(math.Sqrt(float64(left) / float64(perPixel) / float64(tileJobs)))
+	if left <= 0 || size <= 2*tileOverlap {
+		return 0, fmt.Errorf("a frame of %dx%d can't be sketched within %d bytes", w, h, share)
+	}
+	return size, nil
+}
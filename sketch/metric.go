@@ -0,0 +1,132 @@
+package sketch
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// maxSqDiff is the largest possible squared distance between two pixels.
+const maxSqDiff = 4 * 0xffff * 0xffff
+
+// An errMap holds the colour distance between the source and the canvas at
+// every pixel, as calcdiff would compute it, so that only the candidate shape
+// has to be scored each iteration. It also keeps the sum of the squared
+// distances for -target.
+type errMap struct {
+	dist []float64
+	w, h int
+	sum  float64
+	tree *errTree // kept up to date, with -focus
+}
+
+func newErrMap(src *plane, canvas *image.RGBA) *errMap {
+	w, h := canvas.Rect.Dx(), canvas.Rect.Dy()
+	m := &errMap{dist: make([]float64, w*h), w: w, h: h}
+	for i := range m.dist {
+		sq := planediff(src.Pix[4*i:4*i+4:4*i+4], canvas.Pix[4*i:4*i+4:4*i+4])
+		m.dist[i] = math.Sqrt(sq)
+		m.sum += sq
+	}
+	return m
+}
+
+// at returns the distance at (x, y), which is zero outside the canvas.
+func (m *errMap) at(x, y int) float64 {
+	if uint(x) >= uint(m.w) || uint(y) >= uint(m.h) {
+		return 0
+	}
+	return m.dist[y*m.w+x]
+}
+
+// set records the squared distance sq at (x, y), inside the canvas.
+func (m *errMap) set(x, y int, sq float64) {
+	i := y*m.w + x
+	m.sum += sq - m.dist[i]*m.dist[i]
+	d := math.Sqrt(sq)
+	if m.tree != nil {
+		m.tree.add(x, y, d-m.dist[i])
+	}
+	m.dist[i] = d
+}
+
+// heatmap returns the error map in false colour, from black for no error
+// through red and yellow to white for a distance of 0xffff or more, as far
+// as from 0 to 0xffff in one channel.
+func (m *errMap) heatmap() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, m.w, m.h))
+	ramp := func(v float64) uint8 { return uint8(math.Round(0xff * math.Max(0, math.Min(1, v)))) }
+	for i, d := range m.dist {
+		t := 3 * math.Min(1, d/0xffff)
+		img.SetRGBA(i%m.w, i/m.w, color.RGBA{ramp(t), ramp(t - 1), ramp(t - 2), 0xff})
+	}
+	return img
+}
+
+// rmsError converts a sum of squared distances over n pixels to the root
+// mean square difference per channel, between 0 and 1.
+func rmsError(sum float64, n int) float64 {
+	return math.Sqrt(sum / (float64(n) * maxSqDiff))
+}
+
+// psnr returns the peak signal to noise ratio of img to src, in decibels,
+// over red, green and blue. It is +Inf if they are the same.
+func psnr(src, img *image.RGBA) float64 {
+	var sum float64
+	for i := range src.Pix {
+		if i%4 != 3 {
+			d := float64(src.Pix[i]) - float64(img.Pix[i])
+			sum += d * d
+		}
+	}
+	mse := sum / float64(len(src.Pix)/4*3)
+	return 10 * math.Log10(0xff*0xff/mse)
+}
+
+// frameDiff returns the root mean square difference between a and b, on the
+// scale of rmsError, looking at every fourth pixel in each direction. Images
+// of different sizes are as different as can be.
+func frameDiff(a, b image.Image) float64 {
+	ra, rb := a.Bounds(), b.Bounds()
+	if ra.Size() != rb.Size() {
+		return 1
+	}
+	var sum float64
+	var n int
+	for y := 0; y < ra.Dy(); y += 4 {
+		for x := 0; x < ra.Dx(); x += 4 {
+			r1, g1, b1, a1 := a.At(ra.Min.X+x, ra.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(rb.Min.X+x, rb.Min.Y+y).RGBA()
+			R := float64(r1) - float64(r2)
+			G := float64(g1) - float64(g2)
+			B := float64(b1) - float64(b2)
+			A := float64(a1) - float64(a2)
+			sum += R*R + G*G + B*B + A*A
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return rmsError(sum, n)
+}
+
+// averageColor returns the mean of img's premultiplied pixels.
+func averageColor(img image.Image) color.RGBA {
+	r := img.Bounds()
+	var sum [4]uint64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			sum[0] += uint64(c.R)
+			sum[1] += uint64(c.G)
+			sum[2] += uint64(c.B)
+			sum[3] += uint64(c.A)
+		}
+	}
+	n := uint64(r.Dx() * r.Dy())
+	if n == 0 {
+		return color.RGBA{}
+	}
+	return color.RGBA{uint8((sum[0] + n/2) / n), uint8((sum[1] + n/2) / n), uint8((sum[2] + n/2) / n), uint8((sum[3] + n/2) / n)}
+}
@@ -0,0 +1,84 @@
+package sketch
+
+import (
+	"bufio"
+	"log"
+	"log/slog"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// With -midi, sketch reads a raw MIDI device, such as /dev/snd/midiC1D0 on
+// Linux, and turns control changes on any channel into changes of the
+// -control parameters, for a MIDI controller's knobs and faders:
+//
+//	CC 1  -l from 1 to 128
+//	CC 2  -alpha from 1 to 255
+//	CC 3  -colors from 0, for all, to 127
+//	CC 4  -rate from no limit at 0, then from 1 to a million a second
+//
+// Other messages are ignored.
+
+// readMIDI starts reading control changes for c from the raw MIDI device.
+func (c *controller) readMIDI(device string) error {
+	f, err := os.Open(device)
+	if err != nil {
+		return err
+	}
+	slog.Info("reading MIDI", "device", device)
+	go func() {
+		r := bufio.NewReader(f)
+		var status byte
+		var data []byte
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				log.Fatalln(err)
+			}
+			switch {
+			case b >= 0xf8:
+				// Real time messages come between the bytes of others.
+				continue
+			case b >= 0x80:
+				status, data = b, data[:0]
+				continue
+			case status&0xf0 != 0xb0:
+				continue
+			}
+			// A status byte carries on over the messages after it that
+			// leave it out.
+			if data = append(data, b); len(data) < 2 {
+				continue
+			}
+			if name, v, ok := midiParam(data[0], data[1]); ok {
+				if _, err := c.queue(url.Values{name: {v}}); err != nil {
+					slog.Warn("MIDI", "controller", data[0], "err", err)
+				}
+			}
+			data = data[:0]
+		}
+	}()
+	return nil
+}
+
+// midiParam returns the -control parameter set by controller cc, and its
+// value at v, from 0 to 127.
+func midiParam(cc, v byte) (name, value string, ok bool) {
+	switch cc {
+	case 1:
+		return "l", strconv.Itoa(1 + int(v)), true
+	case 2:
+		return "alpha", strconv.Itoa(1 + int(v)*254/127), true
+	case 3:
+		return "colors", strconv.Itoa(int(v)), true
+	case 4:
+		rate := 0.0
+		if v > 0 {
+			rate = math.Round(math.Pow(10, float64(v-1)*6/126))
+		}
+		return "rate", strconv.FormatFloat(rate, 'f', -1, 64), true
+	}
+	return "", "", false
+}
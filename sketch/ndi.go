@@ -0,0 +1,68 @@
+//go:build ndi
+
+package sketch
+
+// With -ndi, the canvas is sent as an NDI video source while it is sketched,
+// so that OBS, Resolume and the like can take the live sketch in over the
+// network. NDI needs the NDI SDK, and is only built with -tags ndi. Spout and
+// Syphon, which share textures on the GPU of one machine, aren't supported;
+// NDI reaches the same programs on any system.
+
+/*
+#cgo linux darwin LDFLAGS: -lndi
+#cgo windows LDFLAGS: -lProcessing.NDI.Lib.x64
+#include <stdlib.h>
+#include <Processing.NDI.Lib.h>
+
+// sendFrame sends w by h RGBA pixels, at up to fps frames a second, which
+// NDI is done with on return.
+static void sendFrame(NDIlib_send_instance_t s, uint8_t *pix, int w, int h, int stride, int fps) {
+	NDIlib_video_frame_v2_t f = {0};
+	f.xres = w;
+	f.yres = h;
+	f.FourCC = NDIlib_FourCC_video_type_RGBA;
+	f.frame_rate_N = fps;
+	f.frame_rate_D = 1;
+	f.picture_aspect_ratio = (float)w / h;
+	f.frame_format_type = NDIlib_frame_format_type_progressive;
+	f.timecode = NDIlib_send_timecode_synthesize;
+	f.p_data = pix;
+	f.line_stride_in_bytes = stride;
+	NDIlib_send_send_video_v2(s, &f);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"time"
+	"unsafe"
+)
+
+// ndiRate is the most frames a second -ndi sends.
+const ndiRate = 30
+
+// runNDI starts sending the copies of the canvas taken from view as the NDI
+// source name. Only copies that have changed are sent; receivers keep
+// showing the last.
+func runNDI(name string, view *snapshot) error {
+	if !C.NDIlib_initialize() {
+		return errors.New("NDI isn't supported on this CPU")
+	}
+	cname := C.CString(name)
+	desc := C.NDIlib_send_create_t{p_ndi_name: cname}
+	s := C.NDIlib_send_create(&desc)
+	if s == nil {
+		return errors.New("can't create the NDI source")
+	}
+	go func() {
+		for range time.Tick(time.Second / ndiRate) {
+			img, _ := view.take()
+			if img == nil {
+				continue
+			}
+			C.sendFrame(s, (*C.uint8_t)(unsafe.Pointer(&img.Pix[0])), C.int(img.Rect.Dx()), C.int(img.Rect.Dy()), C.int(img.Stride), ndiRate)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !ndi
+
+package sketch
+
+import "errors"
+
+func runNDI(name string, view *snapshot) error {
+	return errors.New("built without NDI, rebuild with -tags ndi")
+}
@@ -0,0 +1,104 @@
+package sketch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"log/slog"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// With -osc, sketch listens for OSC messages on a UDP address, such as those
+// of TouchOSC or a Max patch, to play it like an instrument. A message to
+// /sketch/name with an integer or float argument changes the -control
+// parameter of that name, as POST /params?name=value would: /sketch/l,
+// /sketch/alpha, /sketch/colors and /sketch/rate, and /sketch/save and
+// /sketch/iter. Floats are rounded for the parameters that take whole
+// numbers.
+
+// oscIntParams are the -control parameters that take whole numbers.
+var oscIntParams = map[string]bool{"l": true, "alpha": true, "iter": true, "colors": true}
+
+// listenOSC starts taking OSC messages for c on addr.
+func (c *controller) listenOSC(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("listening for OSC", "addr", conn.LocalAddr())
+	go func() {
+		buf := make([]byte, 1<<16)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			c.oscPacket(buf[:n])
+		}
+	}()
+	return nil
+}
+
+// oscPacket queues the change asked for by an OSC message, or by each of
+// the messages in a bundle.
+func (c *controller) oscPacket(b []byte) {
+	if bytes.HasPrefix(b, []byte("#bundle\x00")) && len(b) >= 16 {
+		// Elements follow the time tag, each after its size. They are
+		// taken at once, whatever the time tag.
+		for b = b[16:]; len(b) >= 4; {
+			n := binary.BigEndian.Uint32(b)
+			if uint64(n) > uint64(len(b)-4) {
+				break
+			}
+			c.oscPacket(b[4 : 4+n])
+			b = b[4+n:]
+		}
+		return
+	}
+	addr, b, ok := oscString(b)
+	if !ok {
+		slog.Warn("bad OSC packet")
+		return
+	}
+	name, ok := strings.CutPrefix(addr, "/sketch/")
+	if !ok {
+		slog.Debug("ignoring OSC message", "addr", addr)
+		return
+	}
+	tags, b, ok := oscString(b)
+	if !ok || len(tags) < 2 || tags[0] != ',' || len(b) < 4 {
+		slog.Warn("OSC message without an argument", "addr", addr)
+		return
+	}
+	var v string
+	switch arg := binary.BigEndian.Uint32(b); tags[1] {
+	case 'i':
+		v = strconv.Itoa(int(int32(arg)))
+	case 'f':
+		f := float64(math.Float32frombits(arg))
+		if oscIntParams[name] {
+			f = math.Round(f)
+		}
+		v = strconv.FormatFloat(f, 'f', -1, 32)
+	default:
+		slog.Warn("OSC argument isn't an integer or float", "addr", addr, "type", string(tags[1]))
+		return
+	}
+	if _, err := c.queue(url.Values{name: {v}}); err != nil {
+		slog.Warn("OSC", "addr", addr, "err", err)
+	}
+}
+
+// oscString returns the OSC string at the start of b, and what follows it.
+func oscString(b []byte) (string, []byte, bool) {
+	i := bytes.IndexByte(b, 0)
+	n := (i + 4) &^ 3 // padded to a multiple of four bytes
+	if i < 0 || n > len(b) {
+		return "", nil, false
+	}
+	return string(b[:i]), b[n:], true
+}
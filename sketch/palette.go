@@ -0,0 +1,215 @@
+package sketch
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// colorModes are the -color modes.
+var colorModes = map[string]bool{"palette": true, "start": true, "mid": true, "avg": true, "best": true}
+
+// A colorPalette is a set of colours for strokes to be drawn in at random,
+// each picked as often as its weight says, by an aliasTable. Each colour is
+// stored once, however many pixels are that colour.
+type colorPalette struct {
+	colors []color.RGBA
+	table  *aliasTable // nil if the colours are equally likely
+}
+
+// newPalette returns the palette of the colours of img, outside the mask m
+// if there is one. With -colors, they are reduced to that many. With -p,
+// each colour is as likely as any other; otherwise colours are as likely as
+// they are common in img, or in a random sample of -palette-size of its
+// pixels if it has more.
+func newPalette(img *image.RGBA, m *mask) *colorPalette {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	n := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if m == nil || !m.at(x, y) {
+				n++
+			}
+		}
+	}
+	counts := map[color.RGBA]int{}
+	var sample []color.RGBA
+	sampled := n > paletteSize && !(palletize && numColors == 0)
+	// The sample is drawn with a generator of its own, so that the strokes
+	// drawn are the same whether or not the image is sampled.
+	rng := rand.New(rand.NewSource(1))
+	seen := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if m != nil && m.at(x, y) {
+				continue
+			}
+			c := img.RGBAAt(x, y)
+			switch {
+			case !sampled:
+				counts[c]++
+			case len(sample) < paletteSize:
+				sample = append(sample, c)
+			default:
+				// Keep each pixel seen with equal probability.
+				if i := rng.Intn(seen + 1); i < paletteSize {
+					sample[i] = c
+				}
+			}
+			seen++
+		}
+	}
+	for _, c := range sample {
+		counts[c]++
+	}
+	if numColors > 0 {
+		counts = quantize(counts, numColors)
+	}
+	if palletize {
+		for c := range counts {
+			counts[c] = 1
+		}
+	}
+	return weightedPalette(counts)
+}
+
+// weightedPalette returns the palette of the colours in weights, each
+// picked in proportion to its weight.
+func weightedPalette(weights map[color.RGBA]int) *colorPalette {
+	p := &colorPalette{colors: make([]color.RGBA, 0, len(weights))}
+	uniform := true
+	for c, w := range weights {
+		p.colors = append(p.colors, c)
+		uniform = uniform && w == weights[p.colors[0]]
+	}
+	// Map order is random, and the colours picked must not be.
+	sort.Slice(p.colors, func(i, j int) bool { return packColor(p.colors[i]) < packColor(p.colors[j]) })
+	if uniform {
+		return p
+	}
+
+	w := make([]float64, len(p.colors))
+	for i, c := range p.colors {
+		w[i] = float64(weights[c])
+	}
+	p.table = new(aliasTable)
+	p.table.build(w)
+	return p
+}
+
+// pick returns a colour from p at random.
+func (p *colorPalette) pick(rng *rand.Rand) color.RGBA {
+	if p.table != nil {
+		return p.colors[p.table.pick(rng)]
+	}
+	return p.colors[rng.Intn(len(p.colors))]
+}
+
+// kmeansRounds is the number of rounds of k-means clustering done by
+// quantize.
+const kmeansRounds = 16
+
+// quantize returns the k colours found by k-means clustering of counts, the
+// number of pixels of each colour, with the number of pixels nearest each.
+// The clusters are seeded by picking, one at a time, the colour with the
+// most pixels times squared distance from those already picked, so that the
+// result is the same from run to run.
+func quantize(counts map[color.RGBA]int, k int) map[color.RGBA]int {
+	colors := make([]color.RGBA, 0, len(counts))
+	for c := range counts {
+		colors = append(colors, c)
+	}
+	sort.Slice(colors, func(i, j int) bool { return packColor(colors[i]) < packColor(colors[j]) })
+	if k > len(colors) {
+		k = len(colors)
+	}
+
+	// dist is the squared distance from each colour to its nearest centre.
+	dist := make([]float64, len(colors))
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+	centres := make([][4]float64, 0, k)
+	for len(centres) < k {
+		best, bestScore := 0, -1.0
+		for i, c := range colors {
+			score := float64(counts[c])
+			if len(centres) > 0 {
+				score *= dist[i]
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		centre := colorVec(colors[best])
+		centres = append(centres, centre)
+		for i, c := range colors {
+			dist[i] = math.Min(dist[i], vecDist(colorVec(c), centre))
+		}
+	}
+
+	nearest := make([]int, len(colors))
+	for round := 0; round < kmeansRounds; round++ {
+		sums := make([][4]float64, k)
+		weights := make([]float64, k)
+		for i, c := range colors {
+			v := colorVec(c)
+			nearest[i] = 0
+			d := vecDist(v, centres[0])
+			for j := 1; j < k; j++ {
+				if dj := vecDist(v, centres[j]); dj < d {
+					nearest[i], d = j, dj
+				}
+			}
+			n := float64(counts[c])
+			for ch := range v {
+				sums[nearest[i]][ch] += n * v[ch]
+			}
+			weights[nearest[i]] += n
+		}
+		if round == kmeansRounds-1 {
+			break
+		}
+		for j := range centres {
+			if weights[j] > 0 {
+				for ch := range centres[j] {
+					centres[j][ch] = sums[j][ch] / weights[j]
+				}
+			}
+		}
+	}
+
+	reduced := make(map[color.RGBA]int, k)
+	for i, c := range colors {
+		v := centres[nearest[i]]
+		reduced[color.RGBA{uint8(v[0] + 0.5), uint8(v[1] + 0.5), uint8(v[2] + 0.5), uint8(v[3] + 0.5)}] += counts[c]
+	}
+	return reduced
+}
+
+func packColor(c color.RGBA) uint32 {
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
+
+func colorVec(c color.RGBA) [4]float64 {
+	return [4]float64{float64(c.R), float64(c.G), float64(c.B), float64(c.A)}
+}
+
+func vecDist(a, b [4]float64) float64 {
+	var d float64
+	for i := range a {
+		d += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return d
+}
+
+// pointColor returns the colour of img at p, or at the pixel nearest p if it
+// is outside img.
+func pointColor(img *image.RGBA, p image.Point) color.RGBA {
+	r := img.Rect
+	p.X = imin(imax(p.X, r.Min.X), r.Max.X-1)
+	p.Y = imin(imax(p.Y, r.Min.Y), r.Max.Y-1)
+	return img.RGBAAt(p.X, p.Y)
+}
@@ -0,0 +1,105 @@
+package sketch
+
+import (
+	"image"
+	"image/color"
+)
+
+// A plane holds an image's samples as float32s on the 16 bit scale of
+// color.Color, in linear light or CIELAB with -metric, laid out like the Pix of an
+// image.RGBA with the same bounds. The source is converted once, so that
+// diffs against the canvas only have to convert the canvas' samples.
+type plane struct {
+	Pix    []float32
+	Stride int
+	Rect   image.Rectangle
+}
+
+func (p *plane) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+// sample16 maps 8 bit samples to the 16 bit scale.
+var sample16 [256]float64
+
+func init() {
+	for i := range sample16 {
+		sample16[i] = float64(i * 0x101)
+	}
+}
+
+// labMetric and linearMetric are whether -metric is lab or linear.
+var labMetric, linearMetric bool
+
+// channelScale scales each channel's samples by the square root of its
+// -weights weight, and weighted is whether any weight isn't 1.
+var channelScale = [4]float64{1, 1, 1, 1}
+var weighted bool
+
+// colorSamples returns the samples of c that the source is compared in.
+func colorSamples(c color.RGBA) [4]float64 {
+	var s [4]float64
+	if labMetric {
+		s = labSamples(c)
+	} else if linearMetric {
+		s = linearSamples(c)
+	} else {
+		s = [4]float64{sample16[c.R], sample16[c.G], sample16[c.B], sample16[c.A]}
+	}
+	if weighted {
+		for i := range s {
+			s[i] *= channelScale[i]
+		}
+	}
+	return s
+}
+
+func newPlane(img *image.RGBA) *plane {
+	p := &plane{make([]float32, len(img.Pix)), img.Stride, img.Rect}
+	if !labMetric && !linearMetric && !weighted {
+		for i, v := range img.Pix {
+			p.Pix[i] = float32(sample16[v])
+		}
+		return p
+	}
+	for i := 0; i < len(img.Pix); i += 4 {
+		q := img.Pix[i : i+4 : i+4]
+		s := colorSamples(color.RGBA{q[0], q[1], q[2], q[3]})
+		for c, v := range s {
+			p.Pix[i+c] = float32(v)
+		}
+	}
+	return p
+}
+
+// planediff returns the squared distance between a plane pixel and an RGBA
+// pixel. Without -metric or -weights, it is equal to pixdiff of the pixel
+// the plane was made from; the samples are exact integers, so no precision
+// is lost.
+func planediff(p []float32, q []uint8) float64 {
+	if labMetric || linearMetric || weighted {
+		return colordiff(p, color.RGBA{q[0], q[1], q[2], q[3]})
+	}
+	R := float64(p[0]) - sample16[q[0]]
+	G := float64(p[1]) - sample16[q[1]]
+	B := float64(p[2]) - sample16[q[2]]
+	A := float64(p[3]) - sample16[q[3]]
+	return R*R + G*G + B*B + A*A
+}
+
+// colordiff returns the squared distance between a plane pixel and c, on
+// the same scale as planediff.
+func colordiff(p []float32, c color.RGBA) float64 {
+	s := colorSamples(c)
+	return samplediff(p, &s)
+}
+
+// samplediff is colordiff for a colour already converted by colorSamples,
+// for the pixels of a candidate, which are all the same colour.
+func samplediff(p []float32, s *[4]float64) float64 {
+	R := float64(p[0]) - s[0]
+	G := float64(p[1]) - s[1]
+	B := float64(p[2]) - s[2]
+	A := float64(p[3]) - s[3]
+	return R*R + G*G + B*B + A*A
+}
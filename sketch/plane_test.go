@@ -0,0 +1,50 @@
+package sketch
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// randomRGBA returns a w by h image of random pixels.
+func randomRGBA(rng *rand.Rand, w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rng.Read(img.Pix)
+	return img
+}
+
+func TestPlanediff(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	a, b := randomRGBA(rng, 64, 64), randomRGBA(rng, 64, 64)
+	p := newPlane(a)
+	for i := 0; i < len(a.Pix); i += 4 {
+		want := pixdiff(a.Pix[i:i+4], b.Pix[i:i+4])
+		if got := planediff(p.Pix[i:i+4], b.Pix[i:i+4]); got != want {
+			t.Fatalf("pixel %d: planediff %v, pixdiff %v", i/4, got, want)
+		}
+	}
+}
+
+func BenchmarkPixdiff(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	src, canvas := randomRGBA(rng, 256, 256), randomRGBA(rng, 256, 256)
+	b.SetBytes(int64(len(src.Pix)))
+	for b.Loop() {
+		var sum float64
+		for i := 0; i < len(src.Pix); i += 4 {
+			sum += pixdiff(src.Pix[i:i+4:i+4], canvas.Pix[i:i+4:i+4])
+		}
+	}
+}
+
+func BenchmarkPlanediff(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	p, canvas := newPlane(randomRGBA(rng, 256, 256)), randomRGBA(rng, 256, 256)
+	b.SetBytes(int64(len(canvas.Pix)))
+	for b.Loop() {
+		var sum float64
+		for i := 0; i < len(p.Pix); i += 4 {
+			sum += planediff(p.Pix[i:i+4:i+4], canvas.Pix[i:i+4:i+4])
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package sketch
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// With -preview, sketch serves a page on the given address that shows the
+// canvas and statistics of the frame being sketched, as of each -stat
+// interval, so that it can be watched converging in a browser. The page gets
+// them over a WebSocket, as a text message of the statistics as JSON, like
+// -stats-format json, and then a binary message of the canvas as PNG. Only
+// as much of the WebSocket protocol as that needs is implemented.
+
+//go:embed preview.html
+var previewPage []byte
+
+// preview is the -preview server, if any.
+var preview *previewHub
+
+// A previewHub sends snapshots of the canvas to the pages watching it.
+type previewHub struct {
+	mu      sync.Mutex
+	clients map[chan previewSnapshot]bool
+}
+
+// A previewSnapshot is the statistics of a frame, as JSON, and its canvas,
+// as PNG.
+type previewSnapshot struct {
+	stats, png []byte
+}
+
+// listenPreview starts serving the preview page on addr.
+func listenPreview(addr string) (*previewHub, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	p := &previewHub{clients: map[chan previewSnapshot]bool{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(previewPage)
+	})
+	mux.HandleFunc("GET /ws", p.serveWebSocket)
+	slog.Info("serving preview", "url", "http://"+ln.Addr().String()+"/")
+	go func() {
+		log.Fatalln(http.Serve(ln, mux))
+	}()
+	return p, nil
+}
+
+// push sends r and canvas to the pages watching, as j.progress. A page that
+// hasn't taken the last snapshot yet misses this one.
+func (p *previewHub) push(r statReport, canvas *image.RGBA) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.clients) == 0 {
+		return
+	}
+	var s previewSnapshot
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		slog.Warn("preview", "err", err)
+		return
+	}
+	s.png = buf.Bytes()
+	s.stats, _ = json.Marshal(r)
+	for c := range p.clients {
+		select {
+		case c <- s:
+		default:
+		}
+	}
+}
+
+// WebSocket opcodes.
+const (
+	wsText   = 1
+	wsBinary = 2
+	wsClose  = 8
+)
+
+// wsGUID is appended to a client's key to accept a WebSocket connection.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+func (p *previewHub) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "not a WebSocket request", http.StatusBadRequest)
+		return
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	h := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(h[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	c := make(chan previewSnapshot, 1)
+	p.mu.Lock()
+	p.clients[c] = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.clients, c)
+		p.mu.Unlock()
+	}()
+
+	// The page sends nothing but a close, which ends the connection, as
+	// does its going away.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			op, err := readWSFrame(rw.Reader)
+			if err != nil || op == wsClose {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case s := <-c:
+			if writeWSFrame(rw.Writer, wsText, s.stats) != nil || writeWSFrame(rw.Writer, wsBinary, s.png) != nil || rw.Flush() != nil {
+				return
+			}
+		case <-gone:
+			writeWSFrame(rw.Writer, wsClose, nil)
+			rw.Flush()
+			return
+		}
+	}
+}
+
+// writeWSFrame writes payload as a single unmasked WebSocket frame.
+func writeWSFrame(w *bufio.Writer, op byte, payload []byte) error {
+	hdr := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		hdr = append(hdr, byte(n))
+	case n < 1<<16:
+		hdr = binary.BigEndian.AppendUint16(append(hdr, 126), uint16(n))
+	default:
+		hdr = binary.BigEndian.AppendUint64(append(hdr, 127), uint64(n))
+	}
+	w.Write(hdr)
+	_, err := w.Write(payload)
+	return err
+}
+
+// readWSFrame reads a frame from a client, and returns its opcode. Its
+// payload is discarded.
+func readWSFrame(r *bufio.Reader) (byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, err
+	}
+	if hdr[1]&0x80 == 0 {
+		return 0, errors.New("unmasked frame from client")
+	}
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, err
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	// The mask key, and then the payload.
+	if _, err := io.CopyN(io.Discard, r, 4+int64(n)); err != nil {
+		return 0, err
+	}
+	return hdr[0] & 0x0f, nil
+}
@@ -0,0 +1,55 @@
+package sketch
+
+import (
+	"log"
+	"log/slog"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiling starts serving net/http/pprof on -pprof and writing a CPU
+// profile to -cpuprofile, if they are set. The returned function stops the
+// CPU profile and writes a heap profile to -memprofile, and is to be called
+// once the run is done.
+func startProfiling() func() {
+	if pprofAddr != "" {
+		go func() {
+			slog.Info("serving pprof", "addr", pprofAddr)
+			log.Fatalln(http.ListenAndServe(pprofAddr, nil))
+		}()
+	}
+	var cpu *os.File
+	if cpuProfile != "" {
+		var err error
+		if cpu, err = os.Create(cpuProfile); err != nil {
+			log.Fatalln(err)
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		if memProfile != "" {
+			f, err := os.Create(memProfile)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			runtime.GC() // for up to date statistics
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				log.Fatalln(err)
+			}
+			if err := f.Close(); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package sketch
+
+import (
+	"image"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// With -pyramid, a frame is sketched coarse to fine: first from its source
+// scaled down by half for each level past the first, where strokes of -l
+// pixels cover that much more of the frame, and then again at each size up
+// to the full one, starting from the canvas of the level before scaled up.
+// The full size gets the frame's iterations, and each level below it a
+// quarter of those of the one above, as it has a quarter of the pixels.
+// Strokes of the coarser levels are scaled up with the canvas for -svg and
+// -strokelog.
+
+// sketchPyramid sketches j level by level, as sketch would at full size.
+func sketchPyramid(j *job) (*image.RGBA, []stroke) {
+	src, warm, jobIters := j.src, j.warm, j.iters
+	iters := jobIters
+	if iters <= 0 {
+		iters = iterLimit
+	}
+	r := src.Bounds()
+	var canvas *image.RGBA
+	var strokes []stroke
+	for k := pyramidLevels - 1; k >= 0; k-- {
+		lr := image.Rect(0, 0, max(r.Dx()>>k, 1), max(r.Dy()>>k, 1))
+		if k > 0 {
+			small := image.NewRGBA(lr)
+			xdraw.ApproxBiLinear.Scale(small, lr, src, r, draw.Src, nil)
+			j.src = small
+		} else {
+			j.src = src
+		}
+		// The first level starts from -warm's canvas, if there is one.
+		if canvas == nil {
+			canvas = warm
+		}
+		if canvas != nil && canvas.Rect != lr {
+			up := image.NewRGBA(lr)
+			xdraw.CatmullRom.Scale(up, lr, canvas, canvas.Rect, draw.Src, nil)
+			canvas = up
+		}
+		j.warm = canvas
+		j.iters = max(iters>>(2*k), 1)
+		j.logger.Debug("sketching level", "level", k, "w", lr.Dx(), "h", lr.Dy(), "iters", j.iters)
+		var level []stroke
+		canvas, level = sketch(j)
+		for _, s := range level {
+			s.shape = scaleShape(s.shape, 1<<k)
+			strokes = append(strokes, s)
+		}
+	}
+	j.src, j.warm, j.iters = src, warm, jobIters
+	return canvas, strokes
+}
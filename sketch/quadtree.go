@@ -0,0 +1,91 @@
+package sketch
+
+import "math/rand"
+
+// With -focus, sketch keeps the error of the canvas summed over a quadtree
+// of cells, updated as strokes are drawn, and places that fraction of
+// candidates by walking down it, taking each quarter in proportion to its
+// error, and then anywhere in the cell of quadLeaf by quadLeaf pixels it
+// ends at. Late in a run, when most of the canvas is done, candidates then
+// go where there is still work to do instead of where there isn't.
+
+// quadLeaf is the width and height of the cells at the foot of the quadtree.
+const quadLeaf = 8
+
+// An errTree is a quadtree of the sums of the error, scaled by a weight per
+// pixel, of the cells of the canvas.
+type errTree struct {
+	w, h   int
+	weight []float64 // per pixel in row order, if not all 1
+	// levels[0] has the sums of the leaf cells, in rows of cols[0], and
+	// each level after it those of the cells of four of the level before,
+	// up to a single cell for the whole canvas.
+	levels [][]float64
+	cols   []int
+}
+
+// newErrTree returns the quadtree of errs, with each pixel's error scaled by
+// weight, if it isn't nil.
+func newErrTree(errs *errMap, weight []float64) *errTree {
+	t := &errTree{w: errs.w, h: errs.h, weight: weight}
+	cols, rows := (t.w+quadLeaf-1)/quadLeaf, (t.h+quadLeaf-1)/quadLeaf
+	for {
+		t.levels = append(t.levels, make([]float64, cols*rows))
+		t.cols = append(t.cols, cols)
+		if cols == 1 && rows == 1 {
+			break
+		}
+		cols, rows = (cols+1)/2, (rows+1)/2
+	}
+	for i, d := range errs.dist {
+		t.add(i%t.w, i/t.w, d)
+	}
+	return t
+}
+
+// add adds d, as the change in the error at (x, y), to the cells it lies in.
+func (t *errTree) add(x, y int, d float64) {
+	if t.weight != nil {
+		d *= t.weight[y*t.w+x]
+	}
+	x, y = x/quadLeaf, y/quadLeaf
+	for k, l := range t.levels {
+		l[y*t.cols[k]+x] += d
+		x, y = x/2, y/2
+	}
+}
+
+// point returns a random point, in a leaf cell picked in proportion to its
+// error. With no error left, any point is as likely as any other.
+func (t *errTree) point(rng *rand.Rand) (x, y int) {
+	top := len(t.levels) - 1
+	if t.levels[top][0] <= 0 {
+		return rng.Intn(t.w), rng.Intn(t.h)
+	}
+	for k := top; k > 0; k-- {
+		// The cell's quarters, those of them there are, at the level
+		// below.
+		l, cols := t.levels[k-1], t.cols[k-1]
+		rows := len(l) / cols
+		var sum [4]float64
+		var total float64
+		for q := range sum {
+			cx, cy := 2*x+q%2, 2*y+q/2
+			if cx < cols && cy < rows {
+				// Sums kept by adding changes can drift below 0.
+				total += max(l[cy*cols+cx], 0)
+			}
+			sum[q] = total
+		}
+		if total <= 0 {
+			return rng.Intn(t.w), rng.Intn(t.h)
+		}
+		v, q := rng.Float64()*total, 0
+		for q < 3 && sum[q] <= v {
+			q++
+		}
+		x, y = 2*x+q%2, 2*y+q/2
+	}
+	x0, y0 := x*quadLeaf, y*quadLeaf
+	return x0 + rng.Intn(min(quadLeaf, t.w-x0)), y0 + rng.Intn(min(quadLeaf, t.h-y0))
+}
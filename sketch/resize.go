@@ -0,0 +1,28 @@
+package sketch
+
+import (
+	"image"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// With -max-dim, a source larger than that across or down is scaled down to
+// fit before it is sketched, with Catmull-Rom resampling, as random search
+// over a huge canvas takes hopelessly long to converge. The factor it was
+// scaled down by is kept, so that the SVG of -svg comes out at the source's
+// full size, and is recorded in the frames of -strokelog.
+
+// fitMaxDim returns src scaled down to fit -max-dim, and the factor by which
+// it was scaled down, which is 1 if it already fits.
+func fitMaxDim(src image.Image) (image.Image, float64) {
+	r := src.Bounds()
+	if maxDim <= 0 || r.Dx() <= maxDim && r.Dy() <= maxDim {
+		return src, 1
+	}
+	k := float64(max(r.Dx(), r.Dy())) / float64(maxDim)
+	w, h := max(int(float64(r.Dx())/k+0.5), 1), max(int(float64(r.Dy())/k+0.5), 1)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Rect, src, r, draw.Src, nil)
+	return dst, k
+}
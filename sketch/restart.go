@@ -0,0 +1,70 @@
+package sketch
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// With -restarts, each frame is sketched that many times over, each with a
+// random number generator of its own, up to -restart-jobs at once, and the
+// sketch left closest to its source, by the RMS error of -target, is kept.
+// The first restart is seeded as the frame would be without -restarts. With
+// -restarts-out, the sketches not kept are written as well, named by
+// restartPattern with the frame's number and the restart's, to compare.
+
+// restartPattern names the sketches of -restarts-out.
+const restartPattern = "restart_%03d_%d"
+
+// restartSeed is added to a frame's seed, times the index of the restart,
+// to seed its restarts.
+const restartSeed = 1 << 32
+
+// A restartResult is a sketch of a frame by one of its restarts.
+type restartResult struct {
+	img     *image.RGBA
+	strokes []stroke
+	rms     float64
+}
+
+// sketchRestarts sketches j -restarts times, returning the best sketch, and
+// with -restarts-out, keeping the others in j.others.
+func sketchRestarts(j *job) (*image.RGBA, []stroke) {
+	results := make([]restartResult, numRestarts)
+	slots := make(chan struct{}, restartJobs)
+	var wg sync.WaitGroup
+	for r := range results {
+		k := &job{n: j.n, src: j.src, bg: j.bg, iters: j.iters, warm: j.warm, warmStrokes: j.warmStrokes, progress: j.progress, seed: j.seed + int64(r)*restartSeed}
+		k.draws = newCountingSource(k.seed)
+		k.rng = rand.New(k.draws)
+		k.logger = j.logger.With("restart", r)
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			img, strokes := k.sketch()
+			results[r] = restartResult{img, strokes, k.rms}
+			k.logger.Info("restart done", "rms_error", math.Round(k.rms*1e5)/1e5)
+		}()
+	}
+	wg.Wait()
+	best := 0
+	for r, res := range results {
+		if res.rms < results[best].rms {
+			best = r
+		}
+	}
+	j.logger.Info("keeping restart", "restart", best)
+	j.rms = results[best].rms
+	if restartsOut {
+		j.others = make([]*image.RGBA, len(results))
+		for r, res := range results {
+			if r != best {
+				j.others[r] = res.img
+			}
+		}
+	}
+	return results[best].img, results[best].strokes
+}
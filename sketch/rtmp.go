@@ -0,0 +1,118 @@
+package sketch
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// With -rtmp, the canvas is streamed live as it is sketched, encoded by
+// ffmpeg as H.264 at rtmpRate frames a second, with silent audio, and pushed
+// to an RTMP server, such as a Twitch or YouTube ingest URL ending in the
+// stream key. The stream is the size of the first frame, and later frames of
+// another size are scaled to it. The last copy of the canvas is sent again
+// until there is a newer one, to keep the frame rate steady.
+
+// rtmpRate is the frame rate of -rtmp streams.
+const rtmpRate = 30
+
+// An rtmpStream streams copies of the canvas taken from a snapshot.
+type rtmpStream struct {
+	url  string
+	view *snapshot
+	stop chan struct{}
+	done chan struct{}
+}
+
+var rtmp *rtmpStream
+
+func streamRTMP(addr string, view *snapshot) *rtmpStream {
+	s := &rtmpStream{url: addr, view: view, stop: make(chan struct{}), done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+func (s *rtmpStream) run() {
+	defer close(s.done)
+	var frame *image.RGBA
+	var cmd *exec.Cmd
+	var pipe io.WriteCloser
+	defer func() {
+		if cmd != nil {
+			pipe.Close()
+			cmd.Wait()
+		}
+	}()
+	t := time.NewTicker(time.Second / rtmpRate)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+		}
+		if img, _ := s.view.take(); img != nil {
+			if frame == nil {
+				frame = image.NewRGBA(image.Rect(0, 0, img.Rect.Dx(), img.Rect.Dy()))
+				var err error
+				if cmd, pipe, err = s.start(frame.Rect.Dx(), frame.Rect.Dy()); err != nil {
+					slog.Warn("not streaming", "err", err)
+					return
+				}
+			}
+			if img.Rect.Size() == frame.Rect.Size() {
+				copy(frame.Pix, img.Pix)
+			} else {
+				xdraw.ApproxBiLinear.Scale(frame, frame.Rect, img, img.Rect, draw.Src, nil)
+			}
+		}
+		if frame == nil {
+			continue
+		}
+		if _, err := pipe.Write(frame.Pix); err != nil {
+			slog.Warn("stream ended", "err", err)
+			return
+		}
+	}
+}
+
+// start starts ffmpeg streaming w by h frames.
+func (s *rtmpStream) start(w, h int) (*exec.Cmd, io.WriteCloser, error) {
+	cmd := exec.Command("ffmpeg", "-loglevel", "error",
+		"-f", "rawvideo", "-pix_fmt", "rgba", "-s", fmt.Sprintf("%dx%d", w, h), "-r", fmt.Sprint(rtmpRate), "-i", "-",
+		"-f", "lavfi", "-i", "anullsrc=channel_layout=stereo:sample_rate=44100",
+		// H.264 needs an even width and height.
+		"-vf", "pad=ceil(iw/2)*2:ceil(ih/2)*2",
+		"-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-pix_fmt", "yuv420p", "-g", fmt.Sprint(2*rtmpRate),
+		"-c:a", "aac", "-shortest", "-f", "flv", s.url)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	pipe, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	// The URL's path has the stream key, which isn't for the log.
+	host := "?"
+	if u, err := url.Parse(s.url); err == nil {
+		host = u.Host
+	}
+	slog.Info("streaming with ffmpeg", "host", host)
+	return cmd, pipe, nil
+}
+
+// close ends the stream.
+func (s *rtmpStream) close() {
+	close(s.stop)
+	<-s.done
+}
@@ -0,0 +1,176 @@
+package sketch
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+// A sampler picks where candidate shapes are placed on a w by h canvas:
+// uniformly, or in proportion to a weight per pixel, or with -focus and
+// -residual, by the error left. With -flow and -angles, it also picks the
+// direction of lines.
+type sampler struct {
+	w, h  int
+	cum   []float64 // running total of the weights in row order, if weighted
+	flow  *flowField
+	tree  *errTree    // with -focus
+	focus float64     // fraction of points placed by tree
+	alias *aliasTable // with -residual, if there is error left
+}
+
+func uniformSampler(w, h int) *sampler {
+	return &sampler{w: w, h: h}
+}
+
+// weightedSampler returns a sampler picking pixels in proportion to weights,
+// which are in row order. If they are all zero, it picks uniformly.
+func weightedSampler(weights []float64, w, h int) *sampler {
+	cum := make([]float64, len(weights))
+	var sum float64
+	for i, wt := range weights {
+		sum += wt
+		cum[i] = sum
+	}
+	if sum == 0 {
+		return uniformSampler(w, h)
+	}
+	return &sampler{w: w, h: h, cum: cum}
+}
+
+func (s *sampler) point(rng *rand.Rand) (x, y int) {
+	if s.tree != nil && rng.Float64() < s.focus {
+		return s.tree.point(rng)
+	}
+	if s.alias != nil {
+		i := s.alias.pick(rng)
+		return i % s.w, i / s.w
+	}
+	if s.cum == nil {
+		return rng.Intn(s.w), rng.Intn(s.h)
+	}
+	v := rng.Float64() * s.cum[len(s.cum)-1]
+	i := sort.Search(len(s.cum), func(i int) bool { return s.cum[i] > v })
+	return i % s.w, i / s.w
+}
+
+// An aliasTable picks indices in proportion to their weights in constant
+// time, by Vose's alias method: an index picked uniformly is kept with the
+// odds prob, or else swapped for its alias.
+type aliasTable struct {
+	prob         []float64
+	alias        []int32
+	small, large []int32 // worklists of build
+}
+
+// build makes t pick in proportion to weights, reusing its memory, and
+// reports whether any of them are above 0.
+func (t *aliasTable) build(weights []float64) bool {
+	var sum float64
+	for _, wt := range weights {
+		sum += wt
+	}
+	if sum <= 0 {
+		return false
+	}
+	n := len(weights)
+	t.prob, t.alias = slices.Grow(t.prob[:0], n)[:n], slices.Grow(t.alias[:0], n)[:n]
+	t.small, t.large = t.small[:0], t.large[:0]
+	for i, wt := range weights {
+		t.prob[i] = wt * float64(n) / sum
+		if t.prob[i] < 1 {
+			t.small = append(t.small, int32(i))
+		} else {
+			t.large = append(t.large, int32(i))
+		}
+	}
+	for len(t.small) > 0 && len(t.large) > 0 {
+		s, l := t.small[len(t.small)-1], t.large[len(t.large)-1]
+		t.small, t.large = t.small[:len(t.small)-1], t.large[:len(t.large)-1]
+		t.alias[s] = l
+		t.prob[l] -= 1 - t.prob[s]
+		if t.prob[l] < 1 {
+			t.small = append(t.small, l)
+		} else {
+			t.large = append(t.large, l)
+		}
+	}
+	// What is left over is 1, but for rounding.
+	for _, i := range t.small {
+		t.prob[i] = 1
+	}
+	for _, i := range t.large {
+		t.prob[i] = 1
+	}
+	return true
+}
+
+func (t *aliasTable) pick(rng *rand.Rand) int {
+	i := rng.Intn(len(t.prob))
+	if rng.Float64() < t.prob[i] {
+		return i
+	}
+	return int(t.alias[i])
+}
+
+// turn returns the random offset (dx, dy) of a line starting at (x, y),
+// turned by the -flow field if there is one, and then to one of the -angles.
+// With -angles alone, the angle is picked at random; with -flow as well, it
+// is the one nearest the field's direction.
+func (s *sampler) turn(rng *rand.Rand, x, y, dx, dy int) (int, int) {
+	if s.flow != nil && uint(x) < uint(s.w) && uint(y) < uint(s.h) {
+		dx, dy = s.flow.turn(y*s.w+x, dx, dy)
+	}
+	if len(lineAngles) == 0 {
+		return dx, dy
+	}
+	var a float64
+	if s.flow != nil {
+		// Angles run anticlockwise, and y runs down.
+		a = nearestAngle(math.Atan2(float64(-dy), float64(dx)))
+	} else {
+		a = lineAngles[rng.Intn(len(lineAngles))]
+	}
+	n := math.Hypot(float64(dx), float64(dy))
+	return int(math.Round(n * math.Cos(a))), -int(math.Round(n * math.Sin(a)))
+}
+
+// nearestAngle returns the one of -angles nearest the direction a, either
+// way along a line.
+func nearestAngle(a float64) float64 {
+	best, bestd := 0.0, math.Inf(1)
+	for _, b := range lineAngles {
+		d := a - b
+		d = math.Abs(d - math.Pi*math.Round(d/math.Pi))
+		if d < bestd {
+			best, bestd = b, d
+		}
+	}
+	return best
+}
+
+// A weightMap scales the colour distance at each pixel of a frame by the
+// luminance of the -weight image, so that strokes are placed and judged by
+// how they do in the parts that matter.
+type weightMap struct {
+	weight []float64 // from 0 to 1
+	w, h   int
+}
+
+func newWeightMap(img image.Image, w, h int) *weightMap {
+	m := &weightMap{weight: make([]float64, w*h), w: w, h: h}
+	for i, y := range scaledGray(img, w, h).Pix {
+		m.weight[i] = float64(y) / 0xff
+	}
+	return m
+}
+
+// at returns the weight at (x, y), which is zero outside the canvas.
+func (m *weightMap) at(x, y int) float64 {
+	if uint(x) >= uint(m.w) || uint(y) >= uint(m.h) {
+		return 0
+	}
+	return m.weight[y*m.w+x]
+}
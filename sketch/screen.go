@@ -0,0 +1,54 @@
+package sketch
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+)
+
+// With -screen, frames are grabbed from the screen by ffmpeg, through X11 on
+// Linux, AVFoundation on macOS or GDI on Windows, -screen-fps times a second,
+// and sketched live like those of -camera, for abstract visualisations of
+// whatever is on the screen. The region is all of the screen, or a rectangle
+// given as WxH+X+Y, as X11 geometries are.
+
+// screenGeometry matches a -screen region.
+var screenGeometry = regexp.MustCompile(`^(\d+)x(\d+)\+(\d+)\+(\d+)$`)
+
+// validScreenRegion reports whether region is a -screen region.
+func validScreenRegion(region string) bool {
+	return region == "all" || screenGeometry.MatchString(region)
+}
+
+func openScreen(region string, rate float64) (*liveSource, error) {
+	r := fmt.Sprint(rate)
+	var input []string
+	switch runtime.GOOS {
+	case "darwin":
+		input = []string{"-f", "avfoundation", "-capture_cursor", "1", "-framerate", r, "-i", "Capture screen 0"}
+	case "windows":
+		input = []string{"-f", "gdigrab", "-framerate", r, "-i", "desktop"}
+	default:
+		display := os.Getenv("DISPLAY")
+		if display == "" {
+			display = ":0"
+		}
+		input = []string{"-f", "x11grab", "-framerate", r, "-i", display}
+	}
+	if m := screenGeometry.FindStringSubmatch(region); m != nil {
+		var g [4]int
+		for i := range g {
+			g[i], _ = strconv.Atoi(m[i+1])
+		}
+		input = append(input, "-vf", fmt.Sprintf("crop=%d:%d:%d:%d", g[0], g[1], g[2], g[3]))
+	}
+	c, err := openLive(input...)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("grabbing the screen with ffmpeg", "region", region)
+	return c, nil
+}
@@ -0,0 +1,256 @@
+package sketch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// The serve subcommand runs sketch as an HTTP service, sketching images
+// posted to it with the flags it was started with, up to -jobs at once:
+//
+//	POST /jobs              sketch the image in the request body
+//	GET  /jobs/{id}         the job's state and latest statistics
+//	GET  /jobs/{id}/canvas  the canvas as of those statistics
+//	GET  /jobs/{id}/result  the sketch, once done
+//
+// A job's iterations can be set by an iter parameter in place of -iter.
+// Images are sent back in -format. Jobs are numbered from 1, and seeded by
+// their number like frames, and kept until sketch exits. With -grpc, the
+// same jobs can be driven by the gRPC service in sketch.proto.
+
+// serveTypes maps -format names to the content types serve sends them as.
+var serveTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"tiff": "image/tiff",
+	"bmp":  "image/bmp",
+}
+
+// A serveJob is a job submitted to the server.
+type serveJob struct {
+	id int
+	j  *job
+
+	mu      sync.Mutex
+	state   string // queued, running or done
+	stats   *statReport
+	canvas  *image.RGBA   // a copy, as of stats
+	changed chan struct{} // closed and replaced on each update
+}
+
+type server struct {
+	seed  int64
+	slots chan struct{} // one per job that can be run at once
+
+	mu   sync.Mutex
+	jobs []*serveJob // by id, less 1
+}
+
+// serve implements the serve subcommand, listening on addr, and for gRPC on
+// grpcAddr if it isn't empty.
+func serve(addr, grpcAddr string, seed int64) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	s := &server{seed: seed, slots: make(chan struct{}, numJobs)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.serveSubmit)
+	mux.HandleFunc("GET /jobs/{id}", s.serveStatus)
+	mux.HandleFunc("GET /jobs/{id}/canvas", s.serveCanvas)
+	mux.HandleFunc("GET /jobs/{id}/result", s.serveResult)
+	srv := &http.Server{Handler: mux}
+	if grpcAddr != "" {
+		if err := listenGRPC(grpcAddr, s); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	// Running jobs stop early on an interrupt, as in a run, and the server
+	// stops with them.
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		srv.Shutdown(context.Background())
+	}()
+
+	slog.Info("serving", "addr", ln.Addr())
+	if err := srv.Serve(ln); err != http.ErrServerClosed {
+		log.Fatalln(err)
+	}
+}
+
+func (s *server) serveSubmit(w http.ResponseWriter, r *http.Request) {
+	iters := 0
+	if v := r.URL.Query().Get("iter"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, fmt.Sprintf("bad iter %q", v), http.StatusBadRequest)
+			return
+		}
+		iters = n
+	}
+	img, _, err := image.Decode(r.Body)
+	if err == nil {
+		img, _, err = cropSource(img)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sj := s.submit(img, iters)
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%d", sj.id))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int{"id": sj.id})
+}
+
+// submit queues img, cropped with -crop, to be sketched, in iters iterations
+// if not 0, and returns its job.
+func (s *server) submit(img image.Image, iters int) *serveJob {
+	s.mu.Lock()
+	sj := &serveJob{id: len(s.jobs) + 1, state: "queued", changed: make(chan struct{})}
+	s.jobs = append(s.jobs, sj)
+	s.mu.Unlock()
+	img, _ = fitMaxDim(img)
+	sj.j = newJob(sj.id, img, 0, s.seed, false)
+	sj.j.iters = iters
+	sj.j.progress = sj.update
+	slog.Info("job submitted", "frame", sj.id, "size", fmt.Sprintf("%dx%d", img.Bounds().Dx(), img.Bounds().Dy()))
+
+	go func() {
+		s.slots <- struct{}{}
+		sj.setState("running")
+		sj.j.run()
+		<-s.slots
+		sj.setState("done")
+		slog.Info("job done", "frame", sj.id)
+	}()
+	return sj
+}
+
+func (sj *serveJob) setState(state string) {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	sj.state = state
+	close(sj.changed)
+	sj.changed = make(chan struct{})
+}
+
+// update records r and a copy of canvas, as j.progress, and passes them on
+// to any -preview.
+func (sj *serveJob) update(r statReport, canvas *image.RGBA) {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	sj.stats = &r
+	if sj.canvas == nil {
+		sj.canvas = image.NewRGBA(canvas.Rect)
+	}
+	copy(sj.canvas.Pix, canvas.Pix)
+	close(sj.changed)
+	sj.changed = make(chan struct{})
+	if preview != nil {
+		preview.push(r, canvas)
+	}
+}
+
+// lookup returns the job numbered id, or nil if there is none.
+func (s *server) lookup(id int) *serveJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.jobs) {
+		return nil
+	}
+	return s.jobs[id-1]
+}
+
+// job returns the job with the id in r's path, or writes an error and returns
+// nil if there is none.
+func (s *server) job(w http.ResponseWriter, r *http.Request) *serveJob {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	var sj *serveJob
+	if err == nil {
+		sj = s.lookup(id)
+	}
+	if sj == nil {
+		http.Error(w, "no such job", http.StatusNotFound)
+	}
+	return sj
+}
+
+func (s *server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	sj := s.job(w, r)
+	if sj == nil {
+		return
+	}
+	sj.mu.Lock()
+	v := struct {
+		ID    int         `json:"id"`
+		State string      `json:"state"`
+		Stats *statReport `json:"stats,omitempty"`
+	}{sj.id, sj.state, sj.stats}
+	sj.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *server) serveCanvas(w http.ResponseWriter, r *http.Request) {
+	sj := s.job(w, r)
+	if sj == nil {
+		return
+	}
+	sj.mu.Lock()
+	img := sj.canvas
+	if sj.state == "done" {
+		img = sj.j.img
+	}
+	if img == nil {
+		sj.mu.Unlock()
+		http.Error(w, "no canvas yet", http.StatusNotFound)
+		return
+	}
+	var buf bytes.Buffer
+	err := encodeImage(&buf, img)
+	sj.mu.Unlock()
+	writeEncoded(w, &buf, err)
+}
+
+func (s *server) serveResult(w http.ResponseWriter, r *http.Request) {
+	sj := s.job(w, r)
+	if sj == nil {
+		return
+	}
+	sj.mu.Lock()
+	done := sj.state == "done"
+	sj.mu.Unlock()
+	if !done {
+		http.Error(w, "job not done", http.StatusConflict)
+		return
+	}
+	var buf bytes.Buffer
+	err := encodeImage(&buf, sj.j.img)
+	writeEncoded(w, &buf, err)
+}
+
+// writeEncoded sends the image encoded in buf, or err if encoding it failed.
+func writeEncoded(w http.ResponseWriter, buf *bytes.Buffer, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", serveTypes[format])
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,564 @@
+package sketch
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"slices"
+)
+
+// A Shape is a candidate primitive that is drawn onto the canvas in a single
+// colour.
+type Shape interface {
+	// Rasterize calls plot once for every pixel the shape covers.
+	Rasterize(plot func(x, y int))
+	// Diff sums the colour distance between the source and clr over the
+	// shape's pixels.
+	Diff(src *plane, clr color.RGBA) float64
+	// Mutate moves the shape's geometry by a small random amount.
+	Mutate(rng *rand.Rand)
+}
+
+// shapes maps -shape names to functions returning a random shape placed by
+// smp, no larger than the -l limit.
+var shapes = map[string]func(rng *rand.Rand, smp *sampler) Shape{
+	"line":     randomLine,
+	"rect":     randomRect,
+	"circle":   randomCircle,
+	"ellipse":  randomEllipse,
+	"triangle": randomTriangle,
+	"stipple":  randomDot,
+	"curve":    randomCurve,
+	"polyline": randomPolyline,
+}
+
+// shapePoints returns the point at which s starts, such as a line's first
+// end or a triangle's first corner, and its middle.
+func shapePoints(s Shape) (start, mid image.Point) {
+	switch g := s.(type) {
+	case *Line:
+		return image.Pt(g.X1, g.Y1), image.Pt((g.X1+g.X2)/2, (g.Y1+g.Y2)/2)
+	case *Curve:
+		return image.Pt(g.X1, g.Y1), image.Pt((g.X1+2*g.CX+g.X2)/4, (g.Y1+2*g.CY+g.Y2)/4)
+	case *Polyline:
+		n := len(g.X) / 2
+		return image.Pt(g.X[0], g.Y[0]), image.Pt(g.X[n], g.Y[n])
+	case *Rect:
+		return image.Pt(g.X1, g.Y1), image.Pt((g.X1+g.X2)/2, (g.Y1+g.Y2)/2)
+	case *Circle:
+		return image.Pt(g.X, g.Y), image.Pt(g.X, g.Y)
+	case *Dot:
+		return image.Pt(g.X, g.Y), image.Pt(g.X, g.Y)
+	case *Ellipse:
+		return image.Pt(g.X, g.Y), image.Pt(g.X, g.Y)
+	case *Triangle:
+		return image.Pt(g.X1, g.Y1), image.Pt((g.X1+g.X2+g.X3)/3, (g.Y1+g.Y2+g.Y3)/3)
+	}
+	panic("unknown shape")
+}
+
+// cloneShape returns a copy of s, to mutate without changing s.
+func cloneShape(s Shape) Shape {
+	switch g := s.(type) {
+	case *Line:
+		c := *g
+		return &c
+	case *Curve:
+		c := *g
+		return &c
+	case *Polyline:
+		return &Polyline{slices.Clone(g.X), slices.Clone(g.Y)}
+	case *Rect:
+		c := *g
+		return &c
+	case *Circle:
+		c := *g
+		return &c
+	case *Dot:
+		c := *g
+		return &c
+	case *Ellipse:
+		c := *g
+		return &c
+	case *Triangle:
+		c := *g
+		return &c
+	}
+	panic("unknown shape")
+}
+
+// scaleShape returns a copy of s scaled up by f about the origin, as it
+// would be drawn on a canvas f times the size.
+func scaleShape(s Shape, f int) Shape {
+	if f == 1 {
+		return s
+	}
+	switch g := s.(type) {
+	case *Line:
+		return &Line{g.X1 * f, g.Y1 * f, g.X2 * f, g.Y2 * f, g.W * f}
+	case *Curve:
+		return &Curve{g.X1 * f, g.Y1 * f, g.CX * f, g.CY * f, g.X2 * f, g.Y2 * f}
+	case *Polyline:
+		p := &Polyline{slices.Clone(g.X), slices.Clone(g.Y)}
+		for i := range p.X {
+			p.X[i], p.Y[i] = p.X[i]*f, p.Y[i]*f
+		}
+		return p
+	case *Rect:
+		return &Rect{g.X1 * f, g.Y1 * f, g.X2 * f, g.Y2 * f}
+	case *Circle:
+		return &Circle{g.X * f, g.Y * f, g.R * f}
+	case *Dot:
+		return &Dot{g.X * f, g.Y * f, g.R * f}
+	case *Ellipse:
+		return &Ellipse{g.X * f, g.Y * f, g.RX * f, g.RY * f}
+	case *Triangle:
+		return &Triangle{g.X1 * f, g.Y1 * f, g.X2 * f, g.Y2 * f, g.X3 * f, g.Y3 * f}
+	}
+	panic("unknown shape")
+}
+
+// moveShape returns a copy of s moved by (dx, dy).
+func moveShape(s Shape, dx, dy int) Shape {
+	switch g := s.(type) {
+	case *Line:
+		return &Line{g.X1 + dx, g.Y1 + dy, g.X2 + dx, g.Y2 + dy, g.W}
+	case *Curve:
+		return &Curve{g.X1 + dx, g.Y1 + dy, g.CX + dx, g.CY + dy, g.X2 + dx, g.Y2 + dy}
+	case *Polyline:
+		p := &Polyline{slices.Clone(g.X), slices.Clone(g.Y)}
+		for i := range p.X {
+			p.X[i], p.Y[i] = p.X[i]+dx, p.Y[i]+dy
+		}
+		return p
+	case *Rect:
+		return &Rect{g.X1 + dx, g.Y1 + dy, g.X2 + dx, g.Y2 + dy}
+	case *Circle:
+		return &Circle{g.X + dx, g.Y + dy, g.R}
+	case *Dot:
+		return &Dot{g.X + dx, g.Y + dy, g.R}
+	case *Ellipse:
+		return &Ellipse{g.X + dx, g.Y + dy, g.RX, g.RY}
+	case *Triangle:
+		return &Triangle{g.X1 + dx, g.Y1 + dy, g.X2 + dx, g.Y2 + dy, g.X3 + dx, g.Y3 + dy}
+	}
+	panic("unknown shape")
+}
+
+func shapeDiff(s Shape, src *plane, clr color.RGBA) float64 {
+	var dif float64
+	cs := colorSamples(clr)
+	s.Rasterize(func(x, y int) { dif += calcdiff(src, &cs, x, y) })
+	return dif
+}
+
+// offset returns a random offset within the line length limit.
+func offset(rng *rand.Rand) int {
+	return -lineLen/2 + rng.Intn(lineLen)
+}
+
+// radius returns a random radius within the line length limit.
+func radius(rng *rand.Rand) int {
+	return 1 + rng.Intn(imax(lineLen/2, 1))
+}
+
+// jitter returns a random offset used to mutate shapes.
+func jitter(rng *rand.Rand) int {
+	d := imax(lineLen/8, 1)
+	return rng.Intn(2*d+1) - d
+}
+
+func imin(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func iabs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func imax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Line is a line from (X1, Y1) to (X2, Y2). It is one pixel wide, drawn like
+// Bresenham's, unless W is more than 1, when it covers the pixels within
+// W/2 of the line, like a round brush W pixels across drawn along it.
+type Line struct {
+	X1, Y1, X2, Y2 int
+	W              int
+}
+
+func randomLine(rng *rand.Rand, smp *sampler) Shape {
+	x1, y1 := smp.point(rng)
+	dx, dy := smp.turn(rng, x1, y1, offset(rng), offset(rng))
+	return &Line{x1, y1, x1 + dx, y1 + dy, lineWidth(rng)}
+}
+
+// lineWidth returns a random width from the -width range.
+func lineWidth(rng *rand.Rand) int {
+	if minWidth == maxWidth {
+		return minWidth
+	}
+	return minWidth + rng.Intn(maxWidth-minWidth+1)
+}
+
+func (l *Line) Rasterize(plot func(x, y int)) {
+	if l.W <= 1 {
+		bline(l.X1, l.Y1, l.X2, l.Y2, plot)
+		return
+	}
+	l.footprint(float64(l.W)/2, func(x, y int, d float64) { plot(x, y) })
+}
+
+// footprint calls plot for each pixel within r of the line, with its
+// distance from it.
+func (l *Line) footprint(r float64, plot func(x, y int, d float64)) {
+	ri := int(math.Ceil(r))
+	x1, x2 := imin(l.X1, l.X2)-ri, imax(l.X1, l.X2)+ri
+	y1, y2 := imin(l.Y1, l.Y2)-ri, imax(l.Y1, l.Y2)+ri
+	dx, dy := float64(l.X2-l.X1), float64(l.Y2-l.Y1)
+	n := dx*dx + dy*dy
+	for y := y1; y <= y2; y++ {
+		for x := x1; x <= x2; x++ {
+			// Distance to the nearest point of the line.
+			px, py := float64(x-l.X1), float64(y-l.Y1)
+			t := 0.0
+			if n > 0 {
+				t = math.Max(0, math.Min(1, (px*dx+py*dy)/n))
+			}
+			ex, ey := px-t*dx, py-t*dy
+			if d2 := ex*ex + ey*ey; d2 <= r*r {
+				plot(x, y, math.Sqrt(d2))
+			}
+		}
+	}
+}
+
+func (l *Line) Diff(src *plane, clr color.RGBA) float64 {
+	if l.W > 1 {
+		return shapeDiff(l, src, clr)
+	}
+	return bdiff(src, clr, l.X1, l.Y1, l.X2, l.Y2)
+}
+
+func (l *Line) Mutate(rng *rand.Rand) {
+	if rng.Intn(2) == 0 {
+		l.X1 += jitter(rng)
+		l.Y1 += jitter(rng)
+	} else {
+		l.X2 += jitter(rng)
+		l.Y2 += jitter(rng)
+	}
+}
+
+// Curve is a one pixel wide quadratic Bézier curve from (X1, Y1) to (X2, Y2),
+// bent toward the control point (CX, CY).
+type Curve struct {
+	X1, Y1, CX, CY, X2, Y2 int
+}
+
+func randomCurve(rng *rand.Rand, smp *sampler) Shape {
+	x1, y1 := smp.point(rng)
+	dx, dy := smp.turn(rng, x1, y1, offset(rng), offset(rng))
+	return &Curve{x1, y1, x1 + offset(rng), y1 + offset(rng), x1 + dx, y1 + dy}
+}
+
+// Rasterize draws the curve as a run of short lines, each about two pixels
+// long, skipping the pixel each shares with the one before.
+func (c *Curve) Rasterize(plot func(x, y int)) {
+	n := int(math.Hypot(float64(c.CX-c.X1), float64(c.CY-c.Y1))+math.Hypot(float64(c.X2-c.CX), float64(c.Y2-c.CY)))/2 + 1
+	px, py := c.X1, c.Y1
+	lx, ly := px-1, py // no pixel plotted yet
+	seg := func(x, y int) {
+		if x != lx || y != ly {
+			plot(x, y)
+			lx, ly = x, y
+		}
+	}
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		a, b, d := (1-t)*(1-t), 2*(1-t)*t, t*t
+		x := int(math.Round(a*float64(c.X1) + b*float64(c.CX) + d*float64(c.X2)))
+		y := int(math.Round(a*float64(c.Y1) + b*float64(c.CY) + d*float64(c.Y2)))
+		bline(px, py, x, y, seg)
+		px, py = x, y
+	}
+}
+
+func (c *Curve) Diff(src *plane, clr color.RGBA) float64 {
+	return shapeDiff(c, src, clr)
+}
+
+func (c *Curve) Mutate(rng *rand.Rand) {
+	switch rng.Intn(3) {
+	case 0:
+		c.X1 += jitter(rng)
+		c.Y1 += jitter(rng)
+	case 1:
+		c.CX += jitter(rng)
+		c.CY += jitter(rng)
+	default:
+		c.X2 += jitter(rng)
+		c.Y2 += jitter(rng)
+	}
+}
+
+// A polyline has 2 to maxSegments segments, each turning from the one before
+// by up to maxTurn.
+const (
+	maxSegments = 5
+	maxTurn     = math.Pi / 3
+)
+
+// Polyline is a one pixel wide run of connected lines through the points
+// (X[i], Y[i]).
+type Polyline struct {
+	X, Y []int
+}
+
+// randomPolyline returns a polyline of short segments, together no longer
+// than the -l limit, heading off in the direction a line would.
+func randomPolyline(rng *rand.Rand, smp *sampler) Shape {
+	x, y := smp.point(rng)
+	dx, dy := smp.turn(rng, x, y, offset(rng), offset(rng))
+	a := math.Atan2(float64(dy), float64(dx))
+	n := 2 + rng.Intn(maxSegments-1)
+	p := &Polyline{[]int{x}, []int{y}}
+	fx, fy := float64(x), float64(y)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			a += (2*rng.Float64() - 1) * maxTurn
+		}
+		l := float64(1 + rng.Intn(imax(lineLen/n, 1)))
+		fx += l * math.Cos(a)
+		fy += l * math.Sin(a)
+		p.X = append(p.X, int(math.Round(fx)))
+		p.Y = append(p.Y, int(math.Round(fy)))
+	}
+	return p
+}
+
+// Rasterize skips the pixel each segment shares with the one before, so that
+// the polyline is scored as a whole, with each pixel counted once where the
+// segments meet.
+func (p *Polyline) Rasterize(plot func(x, y int)) {
+	lx, ly := p.X[0]-1, p.Y[0] // no pixel plotted yet
+	seg := func(x, y int) {
+		if x != lx || y != ly {
+			plot(x, y)
+			lx, ly = x, y
+		}
+	}
+	for i := 1; i < len(p.X); i++ {
+		bline(p.X[i-1], p.Y[i-1], p.X[i], p.Y[i], seg)
+	}
+}
+
+func (p *Polyline) Diff(src *plane, clr color.RGBA) float64 {
+	return shapeDiff(p, src, clr)
+}
+
+func (p *Polyline) Mutate(rng *rand.Rand) {
+	i := rng.Intn(len(p.X))
+	p.X[i] += jitter(rng)
+	p.Y[i] += jitter(rng)
+}
+
+// Rect is a filled axis-aligned rectangle with corners (X1, Y1) and (X2, Y2),
+// inclusive.
+type Rect struct {
+	X1, Y1, X2, Y2 int
+}
+
+func randomRect(rng *rand.Rand, smp *sampler) Shape {
+	x1, y1 := smp.point(rng)
+	return &Rect{x1, y1, x1 + offset(rng), y1 + offset(rng)}
+}
+
+func (r *Rect) Rasterize(plot func(x, y int)) {
+	x1, x2 := imin(r.X1, r.X2), imax(r.X1, r.X2)
+	y1, y2 := imin(r.Y1, r.Y2), imax(r.Y1, r.Y2)
+	for y := y1; y <= y2; y++ {
+		for x := x1; x <= x2; x++ {
+			plot(x, y)
+		}
+	}
+}
+
+func (r *Rect) Diff(src *plane, clr color.RGBA) float64 {
+	return shapeDiff(r, src, clr)
+}
+
+func (r *Rect) Mutate(rng *rand.Rand) {
+	if rng.Intn(2) == 0 {
+		r.X1 += jitter(rng)
+		r.Y1 += jitter(rng)
+	} else {
+		r.X2 += jitter(rng)
+		r.Y2 += jitter(rng)
+	}
+}
+
+// Circle is a filled circle covering the pixels within R of (X, Y).
+type Circle struct {
+	X, Y, R int
+}
+
+func randomCircle(rng *rand.Rand, smp *sampler) Shape {
+	x, y := smp.point(rng)
+	return &Circle{x, y, radius(rng)}
+}
+
+func (c *Circle) Rasterize(plot func(x, y int)) {
+	for dy := -c.R; dy <= c.R; dy++ {
+		dx := int(math.Sqrt(float64(c.R*c.R - dy*dy)))
+		for x := c.X - dx; x <= c.X+dx; x++ {
+			plot(x, c.Y+dy)
+		}
+	}
+}
+
+func (c *Circle) Diff(src *plane, clr color.RGBA) float64 {
+	return shapeDiff(c, src, clr)
+}
+
+func (c *Circle) Mutate(rng *rand.Rand) {
+	if rng.Intn(2) == 0 {
+		c.X += jitter(rng)
+		c.Y += jitter(rng)
+	} else {
+		c.R = imax(c.R+jitter(rng), 0)
+	}
+}
+
+// dotRadius is the largest radius of a stipple dot.
+const dotRadius = 2
+
+// Dot is a stipple dot: a single pixel, or a small circle of radius R.
+type Dot struct {
+	X, Y, R int
+}
+
+func randomDot(rng *rand.Rand, smp *sampler) Shape {
+	x, y := smp.point(rng)
+	return &Dot{x, y, rng.Intn(dotRadius + 1)}
+}
+
+func (d *Dot) Rasterize(plot func(x, y int)) {
+	(*Circle)(d).Rasterize(plot)
+}
+
+func (d *Dot) Diff(src *plane, clr color.RGBA) float64 {
+	return shapeDiff(d, src, clr)
+}
+
+func (d *Dot) Mutate(rng *rand.Rand) {
+	if rng.Intn(2) == 0 {
+		d.X += rng.Intn(3) - 1
+		d.Y += rng.Intn(3) - 1
+	} else {
+		d.R = rng.Intn(dotRadius + 1)
+	}
+}
+
+// Ellipse is a filled axis-aligned ellipse centred on (X, Y) with radii RX
+// and RY.
+type Ellipse struct {
+	X, Y, RX, RY int
+}
+
+func randomEllipse(rng *rand.Rand, smp *sampler) Shape {
+	x, y := smp.point(rng)
+	return &Ellipse{x, y, radius(rng), radius(rng)}
+}
+
+func (e *Ellipse) Rasterize(plot func(x, y int)) {
+	for dy := -e.RY; dy <= e.RY; dy++ {
+		dx := e.RX
+		if e.RY > 0 {
+			f := float64(dy) / float64(e.RY)
+			dx = int(float64(e.RX) * math.Sqrt(1-f*f))
+		}
+		for x := e.X - dx; x <= e.X+dx; x++ {
+			plot(x, e.Y+dy)
+		}
+	}
+}
+
+func (e *Ellipse) Diff(src *plane, clr color.RGBA) float64 {
+	return shapeDiff(e, src, clr)
+}
+
+func (e *Ellipse) Mutate(rng *rand.Rand) {
+	switch rng.Intn(3) {
+	case 0:
+		e.X += jitter(rng)
+		e.Y += jitter(rng)
+	case 1:
+		e.RX = imax(e.RX+jitter(rng), 0)
+	default:
+		e.RY = imax(e.RY+jitter(rng), 0)
+	}
+}
+
+// Triangle is a filled triangle, including the pixels on its edges.
+type Triangle struct {
+	X1, Y1, X2, Y2, X3, Y3 int
+}
+
+func randomTriangle(rng *rand.Rand, smp *sampler) Shape {
+	x1, y1 := smp.point(rng)
+	return &Triangle{x1, y1, x1 + offset(rng), y1 + offset(rng), x1 + offset(rng), y1 + offset(rng)}
+}
+
+// edge is positive when (x, y) lies to the left of the edge from (x1, y1) to
+// (x2, y2), and zero when it is on it.
+func edge(x1, y1, x2, y2, x, y int) int {
+	return (x2-x1)*(y-y1) - (y2-y1)*(x-x1)
+}
+
+func (t *Triangle) Rasterize(plot func(x, y int)) {
+	x1, x2 := imin(t.X1, imin(t.X2, t.X3)), imax(t.X1, imax(t.X2, t.X3))
+	y1, y2 := imin(t.Y1, imin(t.Y2, t.Y3)), imax(t.Y1, imax(t.Y2, t.Y3))
+	sign := 1
+	if edge(t.X1, t.Y1, t.X2, t.Y2, t.X3, t.Y3) < 0 {
+		sign = -1
+	}
+	for y := y1; y <= y2; y++ {
+		for x := x1; x <= x2; x++ {
+			if sign*edge(t.X1, t.Y1, t.X2, t.Y2, x, y) >= 0 &&
+				sign*edge(t.X2, t.Y2, t.X3, t.Y3, x, y) >= 0 &&
+				sign*edge(t.X3, t.Y3, t.X1, t.Y1, x, y) >= 0 {
+				plot(x, y)
+			}
+		}
+	}
+}
+
+func (t *Triangle) Diff(src *plane, clr color.RGBA) float64 {
+	return shapeDiff(t, src, clr)
+}
+
+func (t *Triangle) Mutate(rng *rand.Rand) {
+	switch rng.Intn(3) {
+	case 0:
+		t.X1 += jitter(rng)
+		t.Y1 += jitter(rng)
+	case 1:
+		t.X2 += jitter(rng)
+		t.Y2 += jitter(rng)
+	default:
+		t.X3 += jitter(rng)
+		t.Y3 += jitter(rng)
+	}
+}
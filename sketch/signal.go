@@ -0,0 +1,32 @@
+package sketch
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// interrupted is set once SIGINT or SIGTERM is received. The sketch loop
+// checks it to stop early and save what it has.
+var interrupted atomic.Bool
+
+// paused is set while sketching is paused, from -window or by SIGUSR2. The
+// sketch loop waits while it is set.
+var paused atomic.Bool
+
+// saveWanted is set by SIGUSR1. The sketch loop makes an incremental save of
+// the canvas when it sees it, whatever the -save interval.
+var saveWanted atomic.Bool
+
+func catchInterrupt() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		slog.Warn("caught signal, saving, interrupt again to quit immediately", "signal", sig)
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+		interrupted.Store(true)
+	}()
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package sketch
+
+// catchPause and catchSave do nothing where there is no SIGUSR2 or SIGUSR1.
+func catchPause() {}
+func catchSave()  {}
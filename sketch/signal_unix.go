@@ -0,0 +1,40 @@
+//go:build unix
+
+package sketch
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// catchPause pauses sketching on SIGUSR2, and resumes it on the next, so that
+// a long run can give the machine up to other work for a while. The time
+// paused isn't counted towards -duration or the statistics.
+func catchPause() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR2)
+	go func() {
+		for range c {
+			if paused.Load() {
+				paused.Store(false)
+				slog.Info("resuming")
+			} else {
+				paused.Store(true)
+				slog.Info("pausing, send SIGUSR2 again to resume")
+			}
+		}
+	}()
+}
+
+// catchSave asks for an incremental save on each SIGUSR1.
+func catchSave() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	go func() {
+		for range c {
+			saveWanted.Store(true)
+		}
+	}()
+}
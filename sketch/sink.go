@@ -0,0 +1,139 @@
+package sketch
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// A sink receives finished frames in order.
+type sink interface {
+	write(img *image.RGBA) error
+	close() error
+}
+
+// fileSink saves each frame to a numbered file named by -out-pattern.
+type fileSink struct{}
+
+func (fileSink) write(img *image.RGBA) error {
+	save(img, fmt.Sprintf(outPattern, saveNum))
+	saveNum++
+	return nil
+}
+
+func (fileSink) close() error {
+	return nil
+}
+
+// verb matches the integer verb of a frame pattern.
+var verb = regexp.MustCompile("%[^a-zA-Z]*[a-zA-Z]")
+
+// lastSaved returns the highest number among the files in -outdir named by
+// pattern and the -format extension, or 0 if there are none.
+func lastSaved(pattern string) (int, error) {
+	dir := outPath(filepath.Dir(pattern))
+	pattern = filepath.Base(pattern) + "." + formatExt[format]
+	loc := verb.FindStringIndex(pattern)
+	re := regexp.MustCompile("^" + regexp.QuoteMeta(pattern[:loc[0]]) + "([0-9]+)" + regexp.QuoteMeta(pattern[loc[1]:]) + "$")
+	names, err := dirNames(dir)
+	if err != nil {
+		return 0, err
+	}
+	last := 0
+	for _, name := range names {
+		if m := re.FindStringSubmatch(name); m != nil {
+			if n, err := strconv.Atoi(m[1]); err == nil && n > last {
+				last = n
+			}
+		}
+	}
+	return last, nil
+}
+
+// stdoutSink writes frames to standard output as a stream of PNG images.
+type stdoutSink struct{}
+
+func (stdoutSink) write(img *image.RGBA) error {
+	w := bufio.NewWriter(os.Stdout)
+	if err := png.Encode(w, img); err != nil {
+		return err
+	}
+	saveNum++
+	return w.Flush()
+}
+
+func (stdoutSink) close() error {
+	return nil
+}
+
+// encodeSink pipes frames into ffmpeg as raw RGBA video, which ffmpeg takes
+// not to be premultiplied. ffmpeg is started on the first frame, once the
+// frame size is known.
+type encodeSink struct {
+	name string
+	w, h int
+	cmd  *exec.Cmd
+	pipe io.WriteCloser
+	row  *image.NRGBA // a row of the frame, converted for ffmpeg
+}
+
+func (e *encodeSink) start(w, h int) error {
+	e.w, e.h = w, h
+	e.cmd = exec.Command("ffmpeg", "-loglevel", "error", "-y",
+		"-f", "rawvideo", "-pix_fmt", "rgba",
+		"-s", fmt.Sprintf("%dx%d", w, h), "-r", fmt.Sprint(fps),
+		"-i", "-", "-pix_fmt", "yuv420p", e.name)
+	e.cmd.Stdout = os.Stderr
+	e.cmd.Stderr = os.Stderr
+	pipe, err := e.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	e.pipe = pipe
+	slog.Info("encoding with ffmpeg", "file", e.name)
+	return e.cmd.Start()
+}
+
+func (e *encodeSink) write(img *image.RGBA) error {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if e.cmd == nil {
+		if err := e.start(w, h); err != nil {
+			return err
+		}
+	}
+	if w != e.w || h != e.h {
+		return fmt.Errorf("frame size %dx%d differs from video size %dx%d", w, h, e.w, e.h)
+	}
+	if e.row == nil {
+		e.row = image.NewNRGBA(image.Rect(0, 0, w, 1))
+	}
+	for y := 0; y < h; y++ {
+		draw.Draw(e.row, e.row.Rect, img, img.Rect.Min.Add(image.Pt(0, y)), draw.Src)
+		if _, err := e.pipe.Write(e.row.Pix); err != nil {
+			return err
+		}
+	}
+	saveNum++
+	return nil
+}
+
+func (e *encodeSink) close() error {
+	if e.cmd == nil {
+		return nil
+	}
+	e.pipe.Close()
+	if err := e.cmd.Wait(); err != nil {
+		return err
+	}
+	slog.Info("wrote", "file", e.name)
+	return nil
+}
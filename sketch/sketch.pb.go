@@ -0,0 +1,428 @@
+//go:build grpc
+
+// The gRPC service of sketch serve -grpc, for other services to drive
+// sketch without running it for each image. sketch.pb.go and
+// sketch_grpc.pb.go are generated from it with
+//
+//	protoc --go_out=. --go-grpc_out=. sketch.proto
+//
+// and then have a //go:build grpc line added, so that sketch only needs
+// gRPC when built with -tags grpc.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: sketch.proto
+
+package sketch
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SubmitJobRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The image to sketch, in any format sketch reads.
+	Image []byte `protobuf:"bytes,1,opt,name=image,proto3" json:"image,omitempty"`
+	// Iterations to sketch it in, in place of -iter, if not 0.
+	Iters         int32 `protobuf:"varint,2,opt,name=iters,proto3" json:"iters,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitJobRequest) Reset() {
+	*x = SubmitJobRequest{}
+	mi := &file_sketch_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitJobRequest) ProtoMessage() {}
+
+func (x *SubmitJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sketch_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitJobRequest.ProtoReflect.Descriptor instead.
+func (*SubmitJobRequest) Descriptor() ([]byte, []int) {
+	return file_sketch_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubmitJobRequest) GetImage() []byte {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+func (x *SubmitJobRequest) GetIters() int32 {
+	if x != nil {
+		return x.Iters
+	}
+	return 0
+}
+
+type JobRef struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobRef) Reset() {
+	*x = JobRef{}
+	mi := &file_sketch_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobRef) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobRef) ProtoMessage() {}
+
+func (x *JobRef) ProtoReflect() protoreflect.Message {
+	mi := &file_sketch_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobRef.ProtoReflect.Descriptor instead.
+func (*JobRef) Descriptor() ([]byte, []int) {
+	return file_sketch_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *JobRef) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type ProgressRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Whether to send the canvas with each update.
+	Canvas        bool `protobuf:"varint,2,opt,name=canvas,proto3" json:"canvas,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProgressRequest) Reset() {
+	*x = ProgressRequest{}
+	mi := &file_sketch_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProgressRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProgressRequest) ProtoMessage() {}
+
+func (x *ProgressRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sketch_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProgressRequest.ProtoReflect.Descriptor instead.
+func (*ProgressRequest) Descriptor() ([]byte, []int) {
+	return file_sketch_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ProgressRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ProgressRequest) GetCanvas() bool {
+	if x != nil {
+		return x.Canvas
+	}
+	return false
+}
+
+type Progress struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// queued, running or done.
+	State        string  `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
+	Iter         int32   `protobuf:"varint,2,opt,name=iter,proto3" json:"iter,omitempty"`
+	IterPerS     float64 `protobuf:"fixed64,3,opt,name=iter_per_s,json=iterPerS,proto3" json:"iter_per_s,omitempty"`
+	Accepted     int32   `protobuf:"varint,4,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	AcceptedPerS float64 `protobuf:"fixed64,5,opt,name=accepted_per_s,json=acceptedPerS,proto3" json:"accepted_per_s,omitempty"`
+	RmsError     float64 `protobuf:"fixed64,6,opt,name=rms_error,json=rmsError,proto3" json:"rms_error,omitempty"`
+	ElapsedS     float64 `protobuf:"fixed64,7,opt,name=elapsed_s,json=elapsedS,proto3" json:"elapsed_s,omitempty"`
+	// The canvas as of these statistics, in -format, if asked for.
+	Canvas        []byte `protobuf:"bytes,8,opt,name=canvas,proto3" json:"canvas,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Progress) Reset() {
+	*x = Progress{}
+	mi := &file_sketch_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Progress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Progress) ProtoMessage() {}
+
+func (x *Progress) ProtoReflect() protoreflect.Message {
+	mi := &file_sketch_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Progress.ProtoReflect.Descriptor instead.
+func (*Progress) Descriptor() ([]byte, []int) {
+	return file_sketch_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Progress) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Progress) GetIter() int32 {
+	if x != nil {
+		return x.Iter
+	}
+	return 0
+}
+
+func (x *Progress) GetIterPerS() float64 {
+	if x != nil {
+		return x.IterPerS
+	}
+	return 0
+}
+
+func (x *Progress) GetAccepted() int32 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *Progress) GetAcceptedPerS() float64 {
+	if x != nil {
+		return x.AcceptedPerS
+	}
+	return 0
+}
+
+func (x *Progress) GetRmsError() float64 {
+	if x != nil {
+		return x.RmsError
+	}
+	return 0
+}
+
+func (x *Progress) GetElapsedS() float64 {
+	if x != nil {
+		return x.ElapsedS
+	}
+	return 0
+}
+
+func (x *Progress) GetCanvas() []byte {
+	if x != nil {
+		return x.Canvas
+	}
+	return nil
+}
+
+type Result struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The sketch, in -format.
+	Image         []byte `protobuf:"bytes,1,opt,name=image,proto3" json:"image,omitempty"`
+	ContentType   string `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_sketch_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_sketch_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_sketch_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Result) GetImage() []byte {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+func (x *Result) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+var File_sketch_proto protoreflect.FileDescriptor
+
+const file_sketch_proto_rawDesc = "" +
+	"\n" +
+	"\fsketch.proto\x12\x06sketch\">\n" +
+	"\x10SubmitJobRequest\x12\x14\n" +
+	"\x05image\x18\x01 \x01(\fR\x05image\x12\x14\n" +
+	"\x05iters\x18\x02 \x01(\x05R\x05iters\"\x18\n" +
+	"\x06JobRef\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\"9\n" +
+	"\x0fProgressRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x16\n" +
+	"\x06canvas\x18\x02 \x01(\bR\x06canvas\"\xe6\x01\n" +
+	"\bProgress\x12\x14\n" +
+	"\x05state\x18\x01 \x01(\tR\x05state\x12\x12\n" +
+	"\x04iter\x18\x02 \x01(\x05R\x04iter\x12\x1c\n" +
+	"\n" +
+	"iter_per_s\x18\x03 \x01(\x01R\biterPerS\x12\x1a\n" +
+	"\baccepted\x18\x04 \x01(\x05R\baccepted\x12$\n" +
+	"\x0eaccepted_per_s\x18\x05 \x01(\x01R\facceptedPerS\x12\x1b\n" +
+	"\trms_error\x18\x06 \x01(\x01R\brmsError\x12\x1b\n" +
+	"\telapsed_s\x18\a \x01(\x01R\belapsedS\x12\x16\n" +
+	"\x06canvas\x18\b \x01(\fR\x06canvas\"A\n" +
+	"\x06Result\x12\x14\n" +
+	"\x05image\x18\x01 \x01(\fR\x05image\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType2\xab\x01\n" +
+	"\x06Sketch\x125\n" +
+	"\tSubmitJob\x12\x18.sketch.SubmitJobRequest\x1a\x0e.sketch.JobRef\x12=\n" +
+	"\x0eStreamProgress\x12\x17.sketch.ProgressRequest\x1a\x10.sketch.Progress0\x01\x12+\n" +
+	"\tGetResult\x12\x0e.sketch.JobRef\x1a\x0e.sketch.ResultB\tZ\a./;mainb\x06proto3"
+
+var (
+	file_sketch_proto_rawDescOnce sync.Once
+	file_sketch_proto_rawDescData []byte
+)
+
+func file_sketch_proto_rawDescGZIP() []byte {
+	file_sketch_proto_rawDescOnce.Do(func() {
+		file_sketch_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_sketch_proto_rawDesc), len(file_sketch_proto_rawDesc)))
+	})
+	return file_sketch_proto_rawDescData
+}
+
+var file_sketch_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_sketch_proto_goTypes = []any{
+	(*SubmitJobRequest)(nil), // 0: sketch.SubmitJobRequest
+	(*JobRef)(nil),           // 1: sketch.JobRef
+	(*ProgressRequest)(nil),  // 2: sketch.ProgressRequest
+	(*Progress)(nil),         // 3: sketch.Progress
+	(*Result)(nil),           // 4: sketch.Result
+}
+var file_sketch_proto_depIdxs = []int32{
+	0, // 0: sketch.Sketch.SubmitJob:input_type -> sketch.SubmitJobRequest
+	2, // 1: sketch.Sketch.StreamProgress:input_type -> sketch.ProgressRequest
+	1, // 2: sketch.Sketch.GetResult:input_type -> sketch.JobRef
+	1, // 3: sketch.Sketch.SubmitJob:output_type -> sketch.JobRef
+	3, // 4: sketch.Sketch.StreamProgress:output_type -> sketch.Progress
+	4, // 5: sketch.Sketch.GetResult:output_type -> sketch.Result
+	3, // [3:6] is the sub-list for method output_type
+	0, // [0:3] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_sketch_proto_init() }
+func file_sketch_proto_init() {
+	if File_sketch_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_sketch_proto_rawDesc), len(file_sketch_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_sketch_proto_goTypes,
+		DependencyIndexes: file_sketch_proto_depIdxs,
+		MessageInfos:      file_sketch_proto_msgTypes,
+	}.Build()
+	File_sketch_proto = out.File
+	file_sketch_proto_goTypes = nil
+	file_sketch_proto_depIdxs = nil
+}
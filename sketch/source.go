@@ -0,0 +1,188 @@
+package sketch
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var hashes = regexp.MustCompile("#+")
+
+// framePattern validates a file name pattern for numbered frames, which must
+// contain a single integer verb or a run of # characters standing for a
+// zero padded number of that width.
+func framePattern(p string) (string, error) {
+	if !strings.Contains(p, "%") {
+		p = hashes.ReplaceAllStringFunc(p, func(h string) string {
+			return fmt.Sprintf("%%0%dd", len(h))
+		})
+	}
+	if strings.Count(p, "%") != 1 || strings.Contains(fmt.Sprintf(p, 1), "%!") {
+		return "", fmt.Errorf("pattern %q needs a single integer verb such as %%03d", p)
+	}
+	return p, nil
+}
+
+// A source yields input frames in order. next returns io.EOF when there are
+// no more frames. Sources reading image files return every frame of an
+// animated GIF.
+type source interface {
+	next() (image.Image, error)
+	close() error
+}
+
+// seqSource reads numbered files named by -in-pattern, stopping at the first
+// one that is missing.
+type seqSource struct {
+	frameQueue
+	n int
+}
+
+func (s *seqSource) next() (image.Image, error) {
+	if img, ok := s.pop(); ok {
+		return img, nil
+	}
+	name := fmt.Sprintf(inPattern, s.n)
+	slog.Debug("looking for", "file", name)
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, io.EOF
+	}
+	defer f.Close()
+	s.n++
+	return s.decode(f)
+}
+
+func (s *seqSource) close() error {
+	return nil
+}
+
+// fileSource reads a list of image files in order.
+type fileSource struct {
+	frameQueue
+	names []string
+}
+
+func (s *fileSource) next() (image.Image, error) {
+	if img, ok := s.pop(); ok {
+		return img, nil
+	}
+	if len(s.names) == 0 {
+		return nil, io.EOF
+	}
+	name := s.names[0]
+	s.names = s.names[1:]
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		slog.Info("reading", "file", name)
+		f, err := openImage(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	src, err := s.decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return src, nil
+}
+
+func (s *fileSource) close() error {
+	return nil
+}
+
+// readImage decodes the named image file, or the image at a URL.
+func readImage(name string) (image.Image, error) {
+	f, err := openImage(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return img, nil
+}
+
+// expandArgs expands glob patterns among the command line arguments. Names
+// without glob metacharacters, and URLs, are kept as they are, so that a
+// missing file is reported when it is opened.
+func expandArgs(args []string) ([]string, error) {
+	var names []string
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") || isURL(arg) {
+			names = append(names, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+		names = append(names, matches...)
+	}
+	return names, nil
+}
+
+// videoSource decodes a video by running ffmpeg and reading its output as a
+// stream of concatenated PNG images.
+type videoSource struct {
+	cmd  *exec.Cmd
+	r    *bufio.Reader
+	done bool
+}
+
+func openVideo(name string) (*videoSource, error) {
+	v, err := decodeWithFFmpeg("-i", name)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("decoding with ffmpeg", "file", name)
+	return v, nil
+}
+
+// decodeWithFFmpeg runs ffmpeg on the input given by the options in input.
+func decodeWithFFmpeg(input ...string) (*videoSource, error) {
+	args := append([]string{"-loglevel", "error"}, input...)
+	cmd := exec.Command("ffmpeg", append(args, "-f", "image2pipe", "-vcodec", "png", "-")...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &videoSource{cmd: cmd, r: bufio.NewReader(out)}, nil
+}
+
+func (v *videoSource) next() (image.Image, error) {
+	if _, err := v.r.Peek(1); err != nil {
+		v.done = true
+		return nil, io.EOF
+	}
+	return png.Decode(v.r)
+}
+
+func (v *videoSource) close() error {
+	if !v.done {
+		// ffmpeg blocks writing frames nobody will read
+		v.cmd.Process.Kill()
+		v.cmd.Wait()
+		return nil
+	}
+	return v.cmd.Wait()
+}
@@ -0,0 +1,222 @@
+package sketch
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// With -metric ssim, a candidate is scored by the structural similarity
+// (SSIM) of the canvas to the source, in red, green and blue, over the
+// windows of pixels around those it covers, rather than by the distance of
+// those pixels alone. It is accepted if it makes those windows more like the
+// source's, so that it is judged by how it fits in with the texture around
+// it. This is much slower than the other metrics.
+
+// ssimRadius is the distance from the middle of a window to its edges.
+const ssimRadius = 3
+
+// ssimC1 and ssimC2 keep SSIM stable in flat windows, for 8 bit samples.
+const (
+	ssimC1 = (0.01 * 0xff) * (0.01 * 0xff)
+	ssimC2 = (0.03 * 0xff) * (0.03 * 0xff)
+)
+
+// An ssimScorer scores candidates by SSIM.
+type ssimScorer struct {
+	src, canvas *image.RGBA
+	m           *mask
+	wm          *weightMap
+
+	changes []ssimChange // what the candidate covers
+	masked  bool         // whether it touches a masked pixel
+	patch   *image.RGBA  // canvas around the candidate, with it drawn
+	sums    [8][]float64 // summed area tables over the patch
+	hits    []float64    // summed area table of the pixels covered
+}
+
+// An ssimChange is a pixel a candidate covers, and by how much.
+type ssimChange struct {
+	x, y int
+	a    float64
+}
+
+func newSSIMScorer(src, canvas *image.RGBA, m *mask, wm *weightMap) *ssimScorer {
+	return &ssimScorer{src: src, canvas: canvas, m: m, wm: wm, patch: new(image.RGBA)}
+}
+
+// reset forgets the pixels added for the last candidate.
+func (s *ssimScorer) reset() {
+	s.changes = s.changes[:0]
+	s.masked = false
+}
+
+// add records that the candidate covers (x, y) by a.
+func (s *ssimScorer) add(x, y int, a float64) {
+	if !(image.Point{x, y}.In(s.canvas.Rect)) {
+		return
+	}
+	if s.m != nil && s.m.at(x, y) {
+		s.masked = true
+	}
+	s.changes = append(s.changes, ssimChange{x, y, a})
+}
+
+// score returns the dissimilarity to the source of the windows the
+// candidate touches, before and after drawing it in clr, each window
+// weighted by -weight. The score before is -Inf if the candidate touches
+// a masked pixel, so that it is never accepted.
+func (s *ssimScorer) score(clr color.RGBA) (before, after float64) {
+	if len(s.changes) == 0 {
+		return 0, 0
+	}
+	r := image.Rect(s.changes[0].x, s.changes[0].y, s.changes[0].x+1, s.changes[0].y+1)
+	for _, c := range s.changes[1:] {
+		r = r.Union(image.Rect(c.x, c.y, c.x+1, c.y+1))
+	}
+	// The windows whose middles are within centres touch the candidate, and
+	// all they cover is within the patch.
+	centres := r.Inset(-ssimRadius).Intersect(s.canvas.Rect)
+	pr := centres.Inset(-ssimRadius).Intersect(s.canvas.Rect)
+
+	s.patch.Rect, s.patch.Stride = pr, 4*pr.Dx()
+	if n := 4 * pr.Dx() * pr.Dy(); cap(s.patch.Pix) < n {
+		s.patch.Pix = make([]uint8, n)
+	} else {
+		s.patch.Pix = s.patch.Pix[:n]
+	}
+	for y := pr.Min.Y; y < pr.Max.Y; y++ {
+		i, j := s.canvas.PixOffset(pr.Min.X, y), s.patch.PixOffset(pr.Min.X, y)
+		copy(s.patch.Pix[j:j+4*pr.Dx()], s.canvas.Pix[i:i+4*pr.Dx()])
+	}
+	for _, c := range s.changes {
+		i := s.patch.PixOffset(c.x, c.y)
+		s.patch.SetRGBA(c.x, c.y, blend(s.patch.Pix[i:i+4:i+4], clr, c.a))
+	}
+
+	pw := pr.Dx()
+	n := (pw + 1) * (pr.Dy() + 1)
+	for k := range s.sums {
+		s.sums[k] = table(s.sums[k], n)
+	}
+	// Windows the candidate doesn't cover are the same either way, and are
+	// left out.
+	s.hits = table(s.hits, n)
+	for _, c := range s.changes {
+		s.hits[(c.y-pr.Min.Y+1)*(pw+1)+c.x-pr.Min.X+1] = 1
+	}
+	for i := pw + 2; i < n; i++ {
+		if i%(pw+1) != 0 {
+			s.hits[i] += s.hits[i-1] + s.hits[i-pw-1] - s.hits[i-pw-2]
+		}
+	}
+	for ch := 0; ch < 3; ch++ {
+		s.sumPatch(pr, ch)
+		for y := centres.Min.Y; y < centres.Max.Y; y++ {
+			for x := centres.Min.X; x < centres.Max.X; x++ {
+				w := image.Rect(x-ssimRadius, y-ssimRadius, x+ssimRadius+1, y+ssimRadius+1).Intersect(pr)
+				if areaSum(s.hits, pr, w) == 0 {
+					continue
+				}
+				k := 1.0
+				if s.wm != nil {
+					k = s.wm.at(x, y)
+				}
+				before += k * (1 - s.window(pr, w, 0))
+				after += k * (1 - s.window(pr, w, 1))
+			}
+		}
+	}
+	if s.masked {
+		before = math.Inf(-1)
+	}
+	return before, after
+}
+
+// sumPatch fills the summed area tables over the patch at pr for channel
+// ch: the source, its square, and the canvas, its square and its product
+// with the source, before the candidate and then after, less the first two.
+func (s *ssimScorer) sumPatch(pr image.Rectangle, ch int) {
+	pw := pr.Dx()
+	t := &s.sums
+	for y := 0; y < pr.Dy(); y++ {
+		src := s.src.Pix[s.src.PixOffset(pr.Min.X, pr.Min.Y+y):]
+		before := s.canvas.Pix[s.canvas.PixOffset(pr.Min.X, pr.Min.Y+y):]
+		after := s.patch.Pix[s.patch.PixOffset(pr.Min.X, pr.Min.Y+y):]
+		var row [8]float64
+		for x := 0; x < pw; x++ {
+			v, b, a := float64(src[4*x+ch]), float64(before[4*x+ch]), float64(after[4*x+ch])
+			row[0] += v
+			row[1] += v * v
+			row[2] += b
+			row[3] += b * b
+			row[4] += v * b
+			row[5] += a
+			row[6] += a * a
+			row[7] += v * a
+			i := (y+1)*(pw+1) + x + 1
+			for k := range row {
+				t[k][i] = t[k][i-pw-1] + row[k]
+			}
+		}
+	}
+}
+
+// window returns the SSIM of the window w, in the patch at pr, before the
+// candidate if after is 0, and after it if after is 1.
+func (s *ssimScorer) window(pr, w image.Rectangle, after int) float64 {
+	pw := pr.Dx() + 1
+	x0, y0, x1, y1 := w.Min.X-pr.Min.X, w.Min.Y-pr.Min.Y, w.Max.X-pr.Min.X, w.Max.Y-pr.Min.Y
+	i00, i01, i10, i11 := y0*pw+x0, y0*pw+x1, y1*pw+x0, y1*pw+x1
+	var m [5]float64
+	for j, k := range [5]int{0, 1, 2 + 3*after, 3 + 3*after, 4 + 3*after} {
+		t := s.sums[k]
+		m[j] = t[i11] - t[i01] - t[i10] + t[i00]
+	}
+	n := float64(w.Dx() * w.Dy())
+	ms, mc := m[0]/n, m[2]/n
+	vs := m[1]/n - ms*ms
+	vc := m[3]/n - mc*mc
+	cov := m[4]/n - ms*mc
+	return (2*ms*mc + ssimC1) * (2*cov + ssimC2) / ((ms*ms + mc*mc + ssimC1) * (vs + vc + ssimC2))
+}
+
+// table returns t cleared, with room for a summed area table of n entries.
+func table(t []float64, n int) []float64 {
+	if cap(t) < n {
+		return make([]float64, n)
+	}
+	t = t[:n]
+	clear(t)
+	return t
+}
+
+// areaSum returns the sum over w of the summed area table t, of the
+// rectangle pr.
+func areaSum(t []float64, pr, w image.Rectangle) float64 {
+	pw := pr.Dx() + 1
+	x0, y0, x1, y1 := w.Min.X-pr.Min.X, w.Min.Y-pr.Min.Y, w.Max.X-pr.Min.X, w.Max.Y-pr.Min.Y
+	return t[y1*pw+x1] - t[y0*pw+x1] - t[y1*pw+x0] + t[y0*pw+x0]
+}
+
+// meanSSIM returns the mean SSIM of img to src, over the windows around
+// every pixel, in red, green and blue.
+func meanSSIM(src, img *image.RGBA) float64 {
+	s := &ssimScorer{src: src, canvas: img, patch: img}
+	r := src.Rect
+	n := (r.Dx() + 1) * (r.Dy() + 1)
+	for k := range s.sums {
+		s.sums[k] = table(nil, n)
+	}
+	var sum float64
+	for ch := 0; ch < 3; ch++ {
+		s.sumPatch(r, ch)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				w := image.Rect(x-ssimRadius, y-ssimRadius, x+ssimRadius+1, y+ssimRadius+1).Intersect(r)
+				sum += s.window(r, w, 0)
+			}
+		}
+	}
+	return sum / float64(3*r.Dx()*r.Dy())
+}
@@ -0,0 +1,110 @@
+package sketch
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// With -stats-format json, each statistics report is written as a line of
+// JSON, to standard output or -stats-out, instead of being logged, so that
+// scripts and dashboards can follow a run's progress. With -stats-file, each
+// is also appended to a CSV file as a row, for plotting afterwards.
+
+// A statReport is a statistics report on frame n, covering the -stat
+// interval before it.
+type statReport struct {
+	Frame      int     `json:"frame"`
+	Iter       int     `json:"iter"`
+	IterRate   float64 `json:"iter_per_s"`
+	Accepted   int     `json:"accepted"` // on the frame so far
+	AcceptRate float64 `json:"accepted_per_s"`
+	RMSError   float64 `json:"rms_error"`
+	Elapsed    float64 `json:"elapsed_s"` // on the frame so far
+}
+
+// statWriter writes reports for -stats-format json. Frames sketched at once
+// share it.
+type statWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	f   io.Closer // the -stats-out file, if any
+	enc *json.Encoder
+}
+
+var statsJSON *statWriter
+
+// openStats returns a statWriter writing to the file name, or to standard
+// output if name is empty.
+func openStats(name string) (*statWriter, error) {
+	s := &statWriter{w: os.Stdout}
+	if name != "" {
+		f, err := createFile(name)
+		if err != nil {
+			return nil, err
+		}
+		s.w, s.f = f, f
+	}
+	s.enc = json.NewEncoder(s.w)
+	return s, nil
+}
+
+func (s *statWriter) write(r statReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(r)
+}
+
+func (s *statWriter) close() error {
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
+
+// statColumns heads the columns of a -stats-file, in the order of the fields
+// of a statReport.
+var statColumns = []string{"frame", "iter", "iter_per_s", "accepted", "accepted_per_s", "rms_error", "elapsed_s"}
+
+// statCSV appends reports to a -stats-file. Frames sketched at once share
+// it.
+type statCSV struct {
+	mu sync.Mutex
+	f  io.WriteCloser
+	w  *csv.Writer
+}
+
+var statsCSV *statCSV
+
+// openStatsCSV opens the -stats-file name for appending, heading it with
+// statColumns if it is new.
+func openStatsCSV(name string) (*statCSV, error) {
+	f, size, err := appendFile(name)
+	if err != nil {
+		return nil, err
+	}
+	s := &statCSV{f: f, w: csv.NewWriter(f)}
+	if size == 0 {
+		s.w.Write(statColumns)
+		s.w.Flush()
+	}
+	return s, nil
+}
+
+func (s *statCSV) write(r statReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	s.w.Write([]string{strconv.Itoa(r.Frame), strconv.Itoa(r.Iter), f(r.IterRate), strconv.Itoa(r.Accepted), f(r.AcceptRate), f(r.RMSError), f(r.Elapsed)})
+	// Each row is written out as it comes, so that a run that dies leaves
+	// all but the last.
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *statCSV) close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,103 @@
+package sketch
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Built with -tags cloud, sketch can read its inputs from, and write its
+// output to, objects in Amazon S3 or Google Cloud Storage, named by
+// s3://bucket/key or gs://bucket/key, so that a batch job in the cloud needs
+// no shared filesystem. Image files, -resume checkpoints and the logs given to
+// replay may be objects, and so may -outdir, -svg, -gif, -checkpoint,
+// -strokelog, -stats-out and -stats-file. Credentials and regions are found
+// the way the AWS and Google Cloud tools find them, and an S3 region or
+// endpoint may also be given as a query parameter, as in
+// s3://bucket/frames?region=eu-west-1. An object can't be appended to, so
+// the logs and statistics replace any object of the name, and are only
+// uploaded when sketch is done with them.
+
+// isObject reports whether name is an S3 or Cloud Storage object.
+func isObject(name string) bool {
+	return strings.HasPrefix(name, "s3://") || strings.HasPrefix(name, "gs://")
+}
+
+// openFile opens the named file or object for reading.
+func openFile(name string) (io.ReadCloser, error) {
+	if isObject(name) {
+		return openObject(name)
+	}
+	return os.Open(name)
+}
+
+// createFile creates the named file or object, replacing any there is.
+func createFile(name string) (io.WriteCloser, error) {
+	if isObject(name) {
+		return createObject(name)
+	}
+	return os.Create(name)
+}
+
+// appendFile opens the named file for appending, creating it if need be. An
+// object is replaced instead. The size is what there is to append to.
+func appendFile(name string) (io.WriteCloser, int64, error) {
+	if isObject(name) {
+		w, err := createObject(name)
+		return w, 0, err
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+// outPath returns the name of the file name in -outdir.
+func outPath(name string) string {
+	if isObject(outDir) {
+		if u, err := url.Parse(outDir); err == nil {
+			u.Path = path.Join(u.Path, filepath.ToSlash(name))
+			return u.String()
+		}
+	}
+	return filepath.Join(outDir, name)
+}
+
+// fileExists reports whether the named file or object exists.
+func fileExists(name string) bool {
+	if isObject(name) {
+		ok, err := objectExists(name)
+		return err == nil && ok
+	}
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// dirNames returns the names of the files in dir, or of the objects under
+// it, or none if there is no such directory.
+func dirNames(dir string) ([]string, error) {
+	if isObject(dir) {
+		return listObjects(dir)
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names, nil
+}
@@ -0,0 +1,274 @@
+package sketch
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log"
+	"os"
+)
+
+// A logEntry is one line of a -strokelog file. An entry with a size starts
+// a new frame; the entries after it are the strokes accepted on that frame,
+// each with its shape and that shape's coordinates.
+// Colours are the canvas' premultiplied #rrggbbaa bytes, so that replaying
+// a log reproduces the canvas exactly.
+type logEntry struct {
+	Frame int     `json:"frame"`
+	Size  []int   `json:"size,omitempty"`
+	Scale float64 `json:"scale,omitempty"` // by which the source was scaled down to size, if not 1
+	Bg    string  `json:"bg,omitempty"`
+	Warm  bool    `json:"warm,omitempty"`
+	AA    bool    `json:"aa,omitempty"`    // strokes drawn with -aa
+	Alpha int     `json:"alpha,omitempty"` // a stroke's -alpha, or in older logs a frame's, if not opaque
+	Brush string  `json:"brush,omitempty"` // -brush tip file
+	Iter  int     `json:"iter,omitempty"`
+	Shape string  `json:"shape,omitempty"`
+	Geom  []int   `json:"geom,omitempty"`
+	Color string  `json:"color,omitempty"`
+}
+
+type strokeLogger struct {
+	f   io.WriteCloser
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+var strokeLog *strokeLogger
+
+func openStrokeLog(name string) (*strokeLogger, error) {
+	f, _, err := appendFile(name)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &strokeLogger{f, w, json.NewEncoder(w)}, nil
+}
+
+// Write errors are sticky in the bufio.Writer and reported by close.
+
+// frame starts frame n, on the background bg, or from the previous frame if
+// warm.
+func (l *strokeLogger) frame(n, w, h int, scale float64, bg color.RGBA, warm bool) {
+	e := logEntry{Frame: n, Size: []int{w, h}, Bg: hexColor(bg), Warm: warm, AA: antialias, Brush: brushFile}
+	if scale != 1 {
+		e.Scale = scale
+	}
+	l.enc.Encode(e)
+}
+
+func (l *strokeLogger) stroke(n int, s stroke) {
+	l.enc.Encode(strokeEntry(n, s))
+}
+
+func (l *strokeLogger) close() error {
+	if err := l.w.Flush(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// strokeEntry returns the log entry for s, accepted on frame n.
+func strokeEntry(n int, s stroke) logEntry {
+	kind, geom := shapeGeom(s.shape)
+	e := logEntry{Frame: n, Iter: s.iter, Shape: kind, Geom: geom, Color: hexColor(s.c)}
+	if s.alpha < 255 {
+		e.Alpha = s.alpha
+	}
+	return e
+}
+
+// entryStroke is the inverse of strokeEntry.
+func entryStroke(e logEntry) (stroke, error) {
+	shape, err := makeShape(e.Shape, e.Geom)
+	if err != nil {
+		return stroke{}, err
+	}
+	c, err := parseHexColor(e.Color)
+	if err != nil {
+		return stroke{}, err
+	}
+	alpha := 255
+	if e.Alpha > 0 {
+		alpha = e.Alpha
+	}
+	return stroke{shape, c, e.Iter, alpha}, nil
+}
+
+// shapeGeom returns the -shape name and coordinates of s.
+func shapeGeom(s Shape) (string, []int) {
+	switch g := s.(type) {
+	case *Line:
+		if g.W > 1 {
+			return "line", []int{g.X1, g.Y1, g.X2, g.Y2, g.W}
+		}
+		return "line", []int{g.X1, g.Y1, g.X2, g.Y2}
+	case *Rect:
+		return "rect", []int{g.X1, g.Y1, g.X2, g.Y2}
+	case *Circle:
+		return "circle", []int{g.X, g.Y, g.R}
+	case *Ellipse:
+		return "ellipse", []int{g.X, g.Y, g.RX, g.RY}
+	case *Triangle:
+		return "triangle", []int{g.X1, g.Y1, g.X2, g.Y2, g.X3, g.Y3}
+	case *Dot:
+		return "stipple", []int{g.X, g.Y, g.R}
+	case *Curve:
+		return "curve", []int{g.X1, g.Y1, g.CX, g.CY, g.X2, g.Y2}
+	case *Polyline:
+		var geom []int
+		for i := range g.X {
+			geom = append(geom, g.X[i], g.Y[i])
+		}
+		return "polyline", geom
+	}
+	panic("unknown shape")
+}
+
+// makeShape is the inverse of shapeGeom.
+func makeShape(kind string, g []int) (Shape, error) {
+	n := map[string]int{"line": 4, "rect": 4, "circle": 3, "ellipse": 4, "triangle": 6, "stipple": 3, "curve": 6}[kind]
+	if kind == "line" && len(g) == 5 {
+		n = 5
+	}
+	if kind == "polyline" && len(g)%2 == 0 && len(g) >= 6 && len(g) <= 2*(maxSegments+1) {
+		n = len(g)
+	}
+	if n == 0 || len(g) != n {
+		return nil, fmt.Errorf("invalid %q shape %v", kind, g)
+	}
+	switch kind {
+	case "line":
+		l := &Line{g[0], g[1], g[2], g[3], 1}
+		if len(g) == 5 {
+			l.W = g[4]
+		}
+		return l, nil
+	case "rect":
+		return &Rect{g[0], g[1], g[2], g[3]}, nil
+	case "circle":
+		return &Circle{g[0], g[1], g[2]}, nil
+	case "ellipse":
+		return &Ellipse{g[0], g[1], g[2], g[3]}, nil
+	case "stipple":
+		return &Dot{g[0], g[1], g[2]}, nil
+	case "curve":
+		return &Curve{g[0], g[1], g[2], g[3], g[4], g[5]}, nil
+	case "polyline":
+		p := &Polyline{}
+		for i := 0; i < len(g); i += 2 {
+			p.X = append(p.X, g[i])
+			p.Y = append(p.Y, g[i+1])
+		}
+		return p, nil
+	}
+	return &Triangle{g[0], g[1], g[2], g[3], g[4], g[5]}, nil
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+func parseHexColor(s string) (color.RGBA, error) {
+	var c color.RGBA
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A); err != nil {
+		return c, fmt.Errorf("invalid colour %q", s)
+	}
+	return c, nil
+}
+
+// replay implements the replay subcommand, which re-renders the frames of a
+// stroke log to PNG files.
+func replay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sketch replay [-o pattern] file")
+		fs.PrintDefaults()
+	}
+	pattern := fs.String("o", "replay_%03d", "output file name `pattern`, formatted with the frame number")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f, err := openFile(fs.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer f.Close()
+
+	var img *image.RGBA
+	var frame int
+	var covered bool // frame was sketched with -aa or -brush
+	var opacity float64
+	var brush string // -brush file loaded into brushTip
+	flush := func() {
+		if img != nil {
+			save(img, fmt.Sprintf(*pattern, frame))
+		}
+	}
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var e logEntry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		switch {
+		case len(e.Size) == 2:
+			flush()
+			bg, err := parseHexColor(e.Bg)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			prev := img
+			img = image.NewRGBA(image.Rect(0, 0, e.Size[0], e.Size[1]))
+			if e.Warm && prev != nil && prev.Rect == img.Rect {
+				copy(img.Pix, prev.Pix)
+			} else {
+				draw.Draw(img, img.Bounds(), &image.Uniform{bg}, image.ZP, draw.Src)
+			}
+			frame, covered, opacity = e.Frame, e.AA || e.Brush != "", 1.0
+			if e.Alpha > 0 {
+				opacity = float64(e.Alpha) / 255
+			}
+			if e.Brush != brush {
+				brushTip = nil
+				if e.Brush != "" {
+					if brushTip, err = loadBrush(e.Brush); err != nil {
+						log.Fatalln(err)
+					}
+				}
+				brush = e.Brush
+			}
+		case e.Shape != "":
+			if img == nil || e.Frame != frame {
+				log.Fatalf("stroke for frame %d outside of its frame\n", e.Frame)
+			}
+			s, err := entryStroke(e)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			// Strokes logged before they had their own alpha take the
+			// frame's.
+			o := opacity
+			if e.Alpha > 0 {
+				o = float64(e.Alpha) / 255
+			}
+			drawStroke(img, s, covered, o)
+		default:
+			log.Fatalln("invalid stroke log entry")
+		}
+	}
+	flush()
+}
@@ -0,0 +1,105 @@
+package sketch
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// A stroke is a shape that was accepted onto the canvas, at iteration iter,
+// with opacity alpha out of 255.
+type stroke struct {
+	shape Shape
+	c     color.RGBA
+	iter  int
+	alpha int
+}
+
+// svgName returns the -svg file name for frame n, which is formatted into
+// the name if it contains a verb.
+func svgName(name string, n int) string {
+	if strings.Contains(name, "%") {
+		return fmt.Sprintf(name, n)
+	}
+	return name
+}
+
+// writeSVG writes strokes as SVG elements over a background rectangle, in the
+// order they were accepted.
+func writeSVG(name string, w, h int, scale float64, bg color.RGBA, strokes []stroke) error {
+	f, err := createFile(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	// With -max-dim, it is drawn at the source's size.
+	fw, fh := int(math.Round(float64(w)*scale)), int(math.Round(float64(h)*scale))
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", fw, fh, w, h)
+	fmt.Fprintf(b, `<rect width="%d" height="%d" %s/>`+"\n", w, h, svgPaint("fill", bg))
+	fmt.Fprintln(b, `<g stroke-width="1" stroke-linecap="square">`)
+	for _, s := range strokes {
+		if s.alpha < 255 {
+			s.c = fade(s.c, float64(s.alpha)/255)
+		}
+		fmt.Fprintln(b, svgElement(s))
+	}
+	fmt.Fprintln(b, "</g>\n</svg>")
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// svgElement returns the SVG element drawing s. Pixel centres sit at half
+// coordinates.
+func svgElement(s stroke) string {
+	switch g := s.shape.(type) {
+	case *Line:
+		if g.W > 1 {
+			return fmt.Sprintf(`<line x1="%d.5" y1="%d.5" x2="%d.5" y2="%d.5" stroke-width="%d" stroke-linecap="round" %s/>`,
+				g.X1, g.Y1, g.X2, g.Y2, g.W, svgPaint("stroke", s.c))
+		}
+		return fmt.Sprintf(`<line x1="%d.5" y1="%d.5" x2="%d.5" y2="%d.5" %s/>`,
+			g.X1, g.Y1, g.X2, g.Y2, svgPaint("stroke", s.c))
+	case *Curve:
+		return fmt.Sprintf(`<path d="M%d.5 %d.5Q%d.5 %d.5 %d.5 %d.5" fill="none" %s/>`,
+			g.X1, g.Y1, g.CX, g.CY, g.X2, g.Y2, svgPaint("stroke", s.c))
+	case *Polyline:
+		var pts []string
+		for i := range g.X {
+			pts = append(pts, fmt.Sprintf("%d.5,%d.5", g.X[i], g.Y[i]))
+		}
+		return fmt.Sprintf(`<polyline points="%s" fill="none" %s/>`, strings.Join(pts, " "), svgPaint("stroke", s.c))
+	case *Rect:
+		return fmt.Sprintf(`<rect x="%d" y="%d" width="%d" height="%d" %s/>`,
+			imin(g.X1, g.X2), imin(g.Y1, g.Y2), iabs(g.X2-g.X1)+1, iabs(g.Y2-g.Y1)+1, svgPaint("fill", s.c))
+	case *Circle:
+		return fmt.Sprintf(`<circle cx="%d.5" cy="%d.5" r="%d.5" %s/>`,
+			g.X, g.Y, g.R, svgPaint("fill", s.c))
+	case *Dot:
+		if g.R == 0 {
+			return fmt.Sprintf(`<rect x="%d" y="%d" width="1" height="1" %s/>`, g.X, g.Y, svgPaint("fill", s.c))
+		}
+		return fmt.Sprintf(`<circle cx="%d.5" cy="%d.5" r="%d.5" %s/>`,
+			g.X, g.Y, g.R, svgPaint("fill", s.c))
+	case *Ellipse:
+		return fmt.Sprintf(`<ellipse cx="%d.5" cy="%d.5" rx="%d.5" ry="%d.5" %s/>`,
+			g.X, g.Y, g.RX, g.RY, svgPaint("fill", s.c))
+	case *Triangle:
+		return fmt.Sprintf(`<polygon points="%d.5,%d.5 %d.5,%d.5 %d.5,%d.5" %s/>`,
+			g.X1, g.Y1, g.X2, g.Y2, g.X3, g.Y3, svgPaint("fill", s.c))
+	}
+	panic("unknown shape")
+}
+
+// svgPaint returns the attributes painting attr (fill or stroke) with c.
+func svgPaint(attr string, c color.RGBA) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == 255 {
+		return fmt.Sprintf(`%s="#%02x%02x%02x"`, attr, n.R, n.G, n.B)
+	}
+	return fmt.Sprintf(`%s="#%02x%02x%02x" %s-opacity="%.3f"`, attr, n.R, n.G, n.B, attr, float64(n.A)/255)
+}
@@ -0,0 +1,150 @@
+package sketch
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// With -term-preview, the canvas is drawn in the terminal every -stat
+// interval, scaled down to termPreviewSize, for watching a sketch over SSH.
+// The Kitty and iTerm2 protocols send it as PNG; sixel, which more terminals
+// understand, sends it in the Plan 9 palette, dithered like -gif frames.
+
+// termPreviewSize is the most pixels across or down a terminal preview is.
+const termPreviewSize = 320
+
+// termProtocols are the -term-preview protocols, other than auto.
+var termProtocols = map[string]bool{"kitty": true, "iterm2": true, "sixel": true}
+
+// termView draws -term-preview images, if any.
+var termView *termPreviewer
+
+type termPreviewer struct {
+	protocol string
+	mu       sync.Mutex // over writes to w
+	w        io.Writer
+}
+
+// newTermPreviewer returns a previewer writing to standard error in
+// protocol, which with auto is guessed from the environment.
+func newTermPreviewer(protocol string) *termPreviewer {
+	if protocol == "auto" {
+		switch {
+		case os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("TERM") == "xterm-kitty":
+			protocol = "kitty"
+		case os.Getenv("TERM_PROGRAM") == "iTerm.app" || os.Getenv("TERM_PROGRAM") == "WezTerm":
+			protocol = "iterm2"
+		default:
+			protocol = "sixel"
+		}
+	}
+	return &termPreviewer{protocol: protocol, w: os.Stderr}
+}
+
+// show draws canvas, scaled down, on a line of its own.
+func (t *termPreviewer) show(canvas *image.RGBA) {
+	img := canvas
+	if r := canvas.Rect; r.Dx() > termPreviewSize || r.Dy() > termPreviewSize {
+		k := float64(termPreviewSize) / float64(max(r.Dx(), r.Dy()))
+		img = image.NewRGBA(image.Rect(0, 0, max(1, int(k*float64(r.Dx()))), max(1, int(k*float64(r.Dy())))))
+		xdraw.ApproxBiLinear.Scale(img, img.Rect, canvas, r, draw.Src, nil)
+	}
+
+	var buf bytes.Buffer
+	if t.protocol == "sixel" {
+		writeSixel(&buf, img)
+	} else {
+		var p bytes.Buffer
+		png.Encode(&p, img)
+		b64 := base64.StdEncoding.EncodeToString(p.Bytes())
+		if t.protocol == "iterm2" {
+			fmt.Fprintf(&buf, "\x1b]1337;File=inline=1;size=%d:%s\a", p.Len(), b64)
+		} else {
+			// Kitty takes the image in chunks of at most 4096 bytes.
+			for i := 0; i < len(b64); i += 4096 {
+				more := 0
+				if i+4096 < len(b64) {
+					more = 1
+				}
+				keys := ""
+				if i == 0 {
+					keys = "a=T,f=100,"
+				}
+				fmt.Fprintf(&buf, "\x1b_G%sm=%d;%s\x1b\\", keys, more, b64[i:min(i+4096, len(b64))])
+			}
+		}
+	}
+	buf.WriteByte('\n')
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.w.Write(buf.Bytes())
+}
+
+// writeSixel writes img to w as sixel graphics.
+func writeSixel(w *bytes.Buffer, img *image.RGBA) {
+	p := image.NewPaletted(img.Rect, palette.Plan9)
+	draw.FloydSteinberg.Draw(p, p.Rect, img, img.Rect.Min)
+	dx, dy := p.Rect.Dx(), p.Rect.Dy()
+
+	fmt.Fprintf(w, "\x1bPq\"1;1;%d;%d", dx, dy)
+	for i, c := range p.Palette {
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(w, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, b*100/0xffff)
+	}
+	// Each band of six rows is drawn a colour at a time, with a bit for
+	// each row the colour is in, and runs of the same sixel shortened.
+	sixels := make([]byte, dx)
+	for y0 := 0; y0 < dy; y0 += 6 {
+		var used [256]bool
+		for y := y0; y < min(y0+6, dy); y++ {
+			for _, i := range p.Pix[y*p.Stride : y*p.Stride+dx] {
+				used[i] = true
+			}
+		}
+		first := true
+		for i := range used {
+			if !used[i] {
+				continue
+			}
+			for x := range sixels {
+				var bits byte
+				for y := y0; y < min(y0+6, dy); y++ {
+					if p.Pix[y*p.Stride+x] == uint8(i) {
+						bits |= 1 << (y - y0)
+					}
+				}
+				sixels[x] = '?' + bits
+			}
+			if !first {
+				w.WriteByte('$')
+			}
+			first = false
+			fmt.Fprintf(w, "#%d", i)
+			for x := 0; x < dx; {
+				n := 1
+				for x+n < dx && sixels[x+n] == sixels[x] {
+					n++
+				}
+				if n > 3 {
+					fmt.Fprintf(w, "!%d%c", n, sixels[x])
+				} else {
+					w.WriteString(strings.Repeat(string(sixels[x]), n))
+				}
+				x += n
+			}
+		}
+		w.WriteByte('-')
+	}
+	w.WriteString("\x1b\\")
+}
@@ -0,0 +1,117 @@
+package sketch
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// With -tiles, a frame is split into tiles of that many pixels square, each
+// overlapping the next by -tile-overlap, which are sketched on their own, up
+// to -tile-jobs at once, each for -iter iterations, and stitched back
+// together. Strokes converge far faster over a small canvas than a large
+// one, so that a poster-size frame can be sketched in a fraction of the
+// time. Each tile is blended into those before it across the overlap, from
+// none of it at its edge to all of it at the overlap's end, to hide the
+// seams.
+
+// tileSeed is added to a frame's seed, times the index of the tile, to seed
+// its tiles.
+const tileSeed = 1 << 40
+
+// tileStarts returns where the tiles of size, overlapping by overlap,
+// across a length of n pixels start.
+func tileStarts(n, size, overlap int) []int {
+	step := size - overlap
+	starts := []int{0}
+	for x := 0; x+size < n; {
+		x += step
+		starts = append(starts, x)
+	}
+	return starts
+}
+
+// sketchTiles sketches j in tiles of size, returning the stitched sketch.
+func sketchTiles(j *job, size int) (*image.RGBA, []stroke) {
+	r := j.src.Bounds()
+	w, h := r.Dx(), r.Dy()
+	// However the tile size was come to, the overlap is less than half a
+	// tile, so that each tile starts past the one before.
+	size = max(size, 1)
+	overlap := min(max(tileOverlap, 0), (size-1)/2)
+	xs, ys := tileStarts(w, size, overlap), tileStarts(h, size, overlap)
+	type tile struct {
+		rect    image.Rectangle
+		img     *image.RGBA
+		strokes []stroke
+		rms     float64
+	}
+	tiles := make([]tile, 0, len(xs)*len(ys))
+	for _, y := range ys {
+		for _, x := range xs {
+			tiles = append(tiles, tile{rect: image.Rect(x, y, min(x+size, w), min(y+size, h))})
+		}
+	}
+	slots := make(chan struct{}, tileJobs)
+	var wg sync.WaitGroup
+	for t := range tiles {
+		tr := tiles[t].rect
+		src := image.NewRGBA(image.Rect(0, 0, tr.Dx(), tr.Dy()))
+		draw.Draw(src, src.Rect, j.src, r.Min.Add(tr.Min), draw.Src)
+		k := &job{n: j.n, src: src, scale: 1, bg: j.bg, iters: j.iters, seed: j.seed + int64(t)*tileSeed}
+		if j.warm != nil {
+			k.warm = image.NewRGBA(src.Rect)
+			draw.Draw(k.warm, k.warm.Rect, j.warm, tr.Min, draw.Src)
+		}
+		k.draws = newCountingSource(k.seed)
+		k.rng = rand.New(k.draws)
+		k.logger = j.logger.With("tile", t)
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			img, strokes := k.sketchOne()
+			tiles[t].img, tiles[t].strokes, tiles[t].rms = img, strokes, k.rms
+		}()
+	}
+	wg.Wait()
+
+	canvas := image.NewRGBA(image.Rect(0, 0, w, h))
+	var strokes []stroke
+	var sq float64
+	var area int
+	for _, t := range tiles {
+		tr := t.rect
+		for y := tr.Min.Y; y < tr.Max.Y; y++ {
+			for x := tr.Min.X; x < tr.Max.X; x++ {
+				// The tile's share of the pixel, across its overlap
+				// with those to its left and above it.
+				a := 1.0
+				if tr.Min.X > 0 {
+					a = math.Min(a, float64(x-tr.Min.X+1)/float64(overlap+1))
+				}
+				if tr.Min.Y > 0 {
+					a = math.Min(a, float64(y-tr.Min.Y+1)/float64(overlap+1))
+				}
+				c := t.img.RGBAAt(x-tr.Min.X, y-tr.Min.Y)
+				if a < 1 {
+					i := canvas.PixOffset(x, y)
+					c = blend(canvas.Pix[i:i+4:i+4], c, a)
+				}
+				canvas.SetRGBA(x, y, c)
+			}
+		}
+		for _, s := range t.strokes {
+			s.shape = moveShape(s.shape, tr.Min.X, tr.Min.Y)
+			strokes = append(strokes, s)
+		}
+		// The tiles' errors put together, counting the overlaps twice.
+		sq += t.rms * t.rms * float64(tr.Dx()*tr.Dy())
+		area += tr.Dx() * tr.Dy()
+	}
+	j.rms = math.Sqrt(sq / float64(area))
+	return canvas, strokes
+}
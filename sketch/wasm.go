@@ -0,0 +1,103 @@
+//go:build js && wasm
+
+package sketch
+
+import (
+	"errors"
+	"flag"
+	"image"
+	"image/draw"
+	"syscall/js"
+)
+
+// Built with GOOS=js GOARCH=wasm, sketch runs in a browser, with
+// wasm_exec.js from the Go distribution, and sets a global sketch object
+// instead of reading and writing files:
+//
+//	sketch.loadImage(imageData, flags)  start sketching an ImageData
+//	sketch.step(n)                      sketch n iterations
+//	sketch.canvasRGBA()                 the canvas, as ImageData's data
+//
+// The flags, if given, are an object of flag names and values, such as
+// {shape: "curve", l: "20"}. loadImage returns null, or an Error if the
+// flags or the image are bad, leaving nothing loaded. Iterations are only done by step, which
+// returns false once the sketch is finished, by -iter, -strokes or -target
+// if they are set. The canvas is as of the last step, or null before it.
+
+const wasm = true
+
+// jsJob is the job loaded by loadImage, with its canvas after the last step.
+var jsJob *job
+var jsCanvas *image.RGBA
+
+func runJS() {
+	flag.Parse()
+	iterLimit = -1
+	setupLogging()
+	api := js.Global().Get("Object").New()
+	api.Set("loadImage", js.FuncOf(jsLoadImage))
+	api.Set("step", js.FuncOf(jsStep))
+	api.Set("canvasRGBA", js.FuncOf(jsCanvasRGBA))
+	js.Global().Set("sketch", api)
+	select {}
+}
+
+func jsLoadImage(this js.Value, args []js.Value) any {
+	if jsJob != nil {
+		jsJob.stop()
+		jsJob, jsCanvas = nil, nil
+	}
+	if len(args) > 1 && args[1].Type() == js.TypeObject {
+		keys := js.Global().Get("Object").Call("keys", args[1])
+		for i := 0; i < keys.Length(); i++ {
+			name := keys.Index(i).String()
+			if err := flag.Set(name, args[1].Get(name).String()); err != nil {
+				return jsError(err)
+			}
+		}
+	}
+	if err := setupSketch(); err != nil {
+		return jsError(err)
+	}
+	seed, err := parseSeed(seedFlag)
+	if err != nil {
+		return jsError(err)
+	}
+
+	data := args[0].Get("data")
+	img := image.NewNRGBA(image.Rect(0, 0, args[0].Get("width").Int(), args[0].Get("height").Int()))
+	if data.Length() != len(img.Pix) {
+		return jsError(errors.New("image data is the wrong size"))
+	}
+	js.CopyBytesToGo(img.Pix, data)
+	jsJob = newJob(0, img, 0, seed, false)
+	jsJob.startSteps()
+	go jsJob.run()
+	return nil
+}
+
+// jsError returns err as a JavaScript Error.
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}
+
+func jsStep(this js.Value, args []js.Value) any {
+	n := args[0].Int()
+	if jsJob == nil || n < 1 {
+		return jsJob != nil
+	}
+	var more bool
+	jsCanvas, more = jsJob.step(n)
+	return more
+}
+
+func jsCanvasRGBA(this js.Value, args []js.Value) any {
+	if jsCanvas == nil {
+		return nil
+	}
+	img := image.NewNRGBA(jsCanvas.Rect)
+	draw.Draw(img, img.Rect, jsCanvas, image.Point{}, draw.Src)
+	data := js.Global().Get("Uint8ClampedArray").New(len(img.Pix))
+	js.CopyBytesToJS(data, img.Pix)
+	return data
+}
@@ -0,0 +1,7 @@
+//go:build !js || !wasm
+
+package sketch
+
+const wasm = false
+
+func runJS() {}
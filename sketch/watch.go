@@ -0,0 +1,116 @@
+package sketch
+
+import (
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// With -watch, sketch watches a directory for image files, and sketches each
+// one that appears, up to -jobs at once, saving it in -outdir under the name
+// of the image with the -format extension, until interrupted. A file is
+// taken once it has stopped changing between two looks at the directory, so
+// that one still being copied in isn't read half written, and is sketched
+// again if it is replaced. Images already in the directory are sketched too,
+// unless they have a sketch in -outdir and -overwrite isn't set, so that
+// sketch can be restarted on a drop folder. Jobs are numbered from 1, and
+// seeded by their number, like those of serve.
+
+// watchPoll is how often the watched directory is looked at.
+const watchPoll = time.Second
+
+// A watchedFile is a file in the watched directory as last seen.
+type watchedFile struct {
+	size  int64
+	mod   time.Time
+	taken bool // sketched, or being sketched, as it is
+}
+
+func watch(dir string, seed int64) {
+	files := map[string]*watchedFile{}
+	slots := make(chan struct{}, numJobs)
+	var wg sync.WaitGroup
+	n := 0
+	slog.Info("watching", "dir", dir)
+	for first := true; !interrupted.Load(); first = false {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() || strings.HasPrefix(name, ".") {
+				continue
+			}
+			fi, err := e.Info()
+			if err != nil {
+				continue // removed since the listing
+			}
+			base := strings.TrimSuffix(name, filepath.Ext(name))
+			f := files[name]
+			if f == nil || f.size != fi.Size() || !f.mod.Equal(fi.ModTime()) {
+				f = &watchedFile{size: fi.Size(), mod: fi.ModTime()}
+				if first && !overwrite {
+					f.taken = fileExists(outPath(base + "." + formatExt[format]))
+				}
+				files[name] = f
+				continue
+			}
+			if f.taken {
+				continue
+			}
+			f.taken = true
+			slots <- struct{}{}
+			if interrupted.Load() {
+				break
+			}
+			n++
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				src, err := readImage(filepath.Join(dir, name))
+				if err == nil {
+					src, _, err = cropSource(src)
+				}
+				if err != nil {
+					slog.Warn("skipping", "err", err)
+					return
+				}
+				src, _ = fitMaxDim(src)
+				j := newJob(n, src, 0, seed, numJobs > 1)
+				j.logger.Info("sketching", "file", name)
+				j.run()
+				j.wait()
+				if interrupted.Load() {
+					// It is sketched again from the start next time.
+					slog.Info("interrupted, not saving", "file", name)
+					return
+				}
+				save(j.img, base)
+			}(n)
+		}
+		time.Sleep(watchPoll)
+	}
+	wg.Wait()
+}
+
+// sameDir reports whether a and b name the same directory.
+func sameDir(a, b string) bool {
+	if a == "" {
+		a = "."
+	}
+	if b == "" {
+		b = "."
+	}
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	return err == nil && os.SameFile(fa, fb)
+}
@@ -0,0 +1,64 @@
+package sketch
+
+import (
+	"image"
+	"sync"
+	"sync/atomic"
+)
+
+// With -window, sketch shows the canvas in a desktop window as it is
+// sketched, with the latest statistics over it. Space pauses and resumes
+// sketching, S saves the canvas as an incremental save, and Q or Escape
+// stops, like an interrupt. The window needs a desktop, and is only built
+// with -tags window.
+
+// liveView is the canvas shown by -window, if any, ndiView that sent by -ndi
+// and rtmpView that streamed by -rtmp.
+var liveView, ndiView, rtmpView *snapshot
+
+// A snapshot holds copies of the canvas being sketched, taken within 50
+// iterations of being asked for, and the latest statistics.
+type snapshot struct {
+	want atomic.Bool
+
+	mu    sync.Mutex
+	img   *image.RGBA // the latest copy
+	shown *image.RGBA // the copy last taken, which offer leaves alone
+	stats *statReport
+	fresh bool // whether img has changed since the last take
+}
+
+// offer copies canvas, if a copy is wanted.
+func (s *snapshot) offer(canvas *image.RGBA) {
+	if !s.want.Swap(false) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.img == nil || s.img.Rect != canvas.Rect {
+		s.img = image.NewRGBA(canvas.Rect)
+	}
+	copy(s.img.Pix, canvas.Pix)
+	s.fresh = true
+}
+
+// report records r, as the latest statistics.
+func (s *snapshot) report(r statReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = &r
+}
+
+// take returns the latest copy, if it has changed, and statistics, and asks
+// for another copy. The copy mustn't be kept after the next take.
+func (s *snapshot) take() (img *image.RGBA, stats *statReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.want.Store(true)
+	if s.fresh {
+		s.img, s.shown = s.shown, s.img
+		img = s.shown
+		s.fresh = false
+	}
+	return img, s.stats
+}
@@ -0,0 +1,83 @@
+//go:build window
+
+package sketch
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const haveWindow = true
+
+// A windowGame shows liveView in the -window window, as an ebiten game.
+type windowGame struct {
+	done  <-chan struct{}
+	shown *image.RGBA // the canvas last taken from liveView
+	img   *ebiten.Image
+	stats *statReport
+}
+
+// runWindow shows the -window window until done is closed or it is closed.
+func runWindow(done <-chan struct{}) error {
+	ebiten.SetWindowTitle("sketch")
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+	return ebiten.RunGame(&windowGame{done: done})
+}
+
+func (g *windowGame) Update() error {
+	select {
+	case <-g.done:
+		return ebiten.Termination
+	default:
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeySpace):
+		paused.Store(!paused.Load())
+	case inpututil.IsKeyJustPressed(ebiten.KeyS) && g.shown != nil:
+		save(g.shown, fmt.Sprintf(incrPattern, incrSaves.Add(1)))
+	case inpututil.IsKeyJustPressed(ebiten.KeyQ), inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		paused.Store(false)
+		interrupted.Store(true)
+	}
+
+	img, stats := liveView.take()
+	if img != nil {
+		if g.img == nil || g.img.Bounds() != img.Rect {
+			g.img = ebiten.NewImage(img.Rect.Dx(), img.Rect.Dy())
+			k := max(1, 640/max(img.Rect.Dx(), img.Rect.Dy()))
+			ebiten.SetWindowSize(k*img.Rect.Dx(), k*img.Rect.Dy())
+		}
+		g.img.WritePixels(img.Pix)
+		g.shown = img
+	}
+	g.stats = stats
+	return nil
+}
+
+func (g *windowGame) Draw(screen *ebiten.Image) {
+	if g.img != nil {
+		sw, sh := screen.Bounds().Dx(), screen.Bounds().Dy()
+		iw, ih := g.img.Bounds().Dx(), g.img.Bounds().Dy()
+		k := min(float64(sw)/float64(iw), float64(sh)/float64(ih))
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(k, k)
+		op.GeoM.Translate((float64(sw)-k*float64(iw))/2, (float64(sh)-k*float64(ih))/2)
+		screen.DrawImage(g.img, op)
+	}
+	msg := "waiting for the canvas"
+	if r := g.stats; r != nil {
+		msg = fmt.Sprintf("frame %d, %d iterations, %.0f iter/s, %d accepted, RMS error %.4f", r.Frame, r.Iter, r.IterRate, r.Accepted, r.RMSError)
+	}
+	if paused.Load() {
+		msg += ", paused"
+	}
+	ebitenutil.DebugPrint(screen, msg+"\nspace: pause, S: save, Q: quit")
+}
+
+func (g *windowGame) Layout(w, h int) (int, int) {
+	return w, h
+}
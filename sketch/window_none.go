@@ -0,0 +1,9 @@
+//go:build !window
+
+package sketch
+
+const haveWindow = false
+
+func runWindow(done <-chan struct{}) error {
+	panic("unreachable")
+}